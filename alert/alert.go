@@ -0,0 +1,163 @@
+package alert
+
+import (
+	"context"
+	"solarizer/solarweb"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/influxdata/influxdb-client-go/v2/api/write"
+)
+
+const (
+	// evaluateInterval is the interval rules are evaluated in without power
+	// samples, e.g. while SolarWeb is unreachable
+	evaluateInterval = time.Minute
+	notifyTimeout    = 30 * time.Second
+)
+
+// Event is sent to the notifiers when an alert fires or resolves.
+type Event struct {
+	Rule    string    `json:"rule"`
+	Firing  bool      `json:"firing"`
+	Message string    `json:"message"`
+	Time    time.Time `json:"time"`
+}
+
+// Notifier delivers events to a notification channel.
+type Notifier interface {
+	Name() string
+	Notify(ctx context.Context, event Event) error
+}
+
+// State is the state of a rule.
+type State struct {
+	Rule         string    `json:"rule"`
+	Firing       bool      `json:"firing"`
+	PendingSince time.Time `json:"pending_since"` // trigger condition holds, but not yet for the duration of the rule
+	FiringSince  time.Time `json:"firing_since"`
+	Message      string    `json:"message,omitempty"`
+}
+
+// Engine evaluates the rules on every power sample and notifies all
+// notifiers about firing and resolved alerts. It implements
+// influx.PowerObserver.
+type Engine struct {
+	rules      []Rule
+	notifiers  []Notifier
+	status     func() solarweb.Status
+	staleAfter time.Duration
+
+	mu         sync.Mutex
+	states     []State
+	sample     *solarweb.CompareData
+	sampleTime time.Time
+
+	notifyWg sync.WaitGroup
+}
+
+// NewEngine creates an engine. status returns the SolarWeb connection state,
+// samples older than staleAfter are stale.
+func NewEngine(rules []Rule, notifiers []Notifier, status func() solarweb.Status, staleAfter time.Duration) *Engine {
+	states := make([]State, len(rules))
+	for i, rule := range rules {
+		states[i].Rule = rule.Name
+	}
+	return &Engine{
+		rules:      rules,
+		notifiers:  notifiers,
+		status:     status,
+		staleAfter: staleAfter,
+		states:     states,
+	}
+}
+
+// ObservePower evaluates the rules with the sample.
+func (e *Engine) ObservePower(now time.Time, data solarweb.CompareData) []*write.Point {
+	e.mu.Lock()
+	if now.After(e.sampleTime) {
+		e.sample, e.sampleTime = &data, now
+	}
+	e.mu.Unlock()
+	e.Evaluate(now)
+	return nil
+}
+
+// Run evaluates the rules periodically until ctx is cancelled, so alerts not
+// depending on power samples fire even if no samples are imported.
+func (e *Engine) Run(ctx context.Context) {
+	ticker := time.NewTicker(evaluateInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			e.Evaluate(now)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Evaluate checks all rules and sends notifications for changed alerts.
+func (e *Engine) Evaluate(now time.Time) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	in := Input{
+		Time:       now,
+		Sample:     e.sample,
+		SampleTime: e.sampleTime,
+		Stale:      e.sample != nil && now.Sub(e.sampleTime) > e.staleAfter,
+		SolarWeb:   e.status(),
+	}
+	for i, rule := range e.rules {
+		st := &e.states[i]
+		result, message := rule.check(in)
+		switch result {
+		case trigger:
+			if st.PendingSince.IsZero() {
+				st.PendingSince = now
+			}
+			st.Message = message
+			if !st.Firing && now.Sub(st.PendingSince) >= rule.For {
+				st.Firing, st.FiringSince = true, now
+				e.notify(Event{Rule: rule.Name, Firing: true, Message: message, Time: now})
+			}
+		case clear:
+			if st.Firing {
+				e.notify(Event{Rule: rule.Name, Firing: false, Message: message, Time: now})
+			}
+			*st = State{Rule: rule.Name}
+		}
+	}
+}
+
+// States returns the state of all rules.
+func (e *Engine) States() []State {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	states := make([]State, len(e.states))
+	copy(states, e.states)
+	return states
+}
+
+// Close waits for pending notifications.
+func (e *Engine) Close() {
+	e.notifyWg.Wait()
+}
+
+// notify sends the event to all notifiers without blocking the evaluation.
+func (e *Engine) notify(event Event) {
+	log.Info("Alert changed", "rule", event.Rule, "firing", event.Firing, "message", event.Message)
+	for _, notifier := range e.notifiers {
+		e.notifyWg.Add(1)
+		go func() {
+			defer e.notifyWg.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+			defer cancel()
+			if err := notifier.Notify(ctx, event); err != nil {
+				log.Error("Error sending notification", "notifier", notifier.Name(), "rule", event.Rule, "err", err)
+			}
+		}()
+	}
+}
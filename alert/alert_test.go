@@ -0,0 +1,207 @@
+package alert
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"solarizer/mail"
+	"solarizer/solarweb"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type recordingNotifier struct {
+	mu     sync.Mutex
+	events []Event
+}
+
+func (n *recordingNotifier) Name() string {
+	return "recording"
+}
+
+func (n *recordingNotifier) Notify(_ context.Context, event Event) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.events = append(n.events, event)
+	return nil
+}
+
+func TestBatteryLowWithDurationAndHysteresis(t *testing.T) {
+	notifier := &recordingNotifier{}
+	engine := NewEngine([]Rule{BatteryLowRule(10, 15, 2*time.Minute)}, []Notifier{notifier},
+		func() solarweb.Status { return solarweb.Status{} }, 15*time.Minute)
+
+	start := time.Date(2025, 6, 1, 22, 0, 0, 0, time.UTC)
+	for i, soc := range []float64{12, 9, 8, 9, 12, 11, 14, 16} {
+		engine.ObservePower(start.Add(time.Duration(i)*time.Minute), solarweb.CompareData{IsOnline: true, BatteryPercentage: soc})
+	}
+	engine.Close()
+
+	// Fires at 22:03 after 2 minutes below 10 %, stays firing between 10 % and
+	// 15 % and resolves at 22:07
+	if len(notifier.events) != 2 {
+		t.Fatalf("events = %+v, want firing and resolved", notifier.events)
+	}
+	// Notifications are sent concurrently
+	slices.SortFunc(notifier.events, func(a, b Event) int { return a.Time.Compare(b.Time) })
+	firing, resolved := notifier.events[0], notifier.events[1]
+	if !firing.Firing || !firing.Time.Equal(start.Add(3*time.Minute)) {
+		t.Fatalf("first event = %+v, want firing at 22:03", firing)
+	}
+	if resolved.Firing || !resolved.Time.Equal(start.Add(7*time.Minute)) {
+		t.Fatalf("second event = %+v, want resolved at 22:07", resolved)
+	}
+}
+
+func TestLoginFailingWithoutSamples(t *testing.T) {
+	notifier := &recordingNotifier{}
+	failures := 2
+	engine := NewEngine([]Rule{LoginFailingRule(3), PVZeroRule(11*time.Hour, 14*time.Hour, 0)}, []Notifier{notifier},
+		func() solarweb.Status {
+			return solarweb.Status{LoginFailures: failures, LastLoginError: "invalid password"}
+		}, 15*time.Minute)
+
+	engine.Evaluate(time.Now())
+	failures = 3
+	engine.Evaluate(time.Now())
+	engine.Close()
+	if len(notifier.events) != 1 || notifier.events[0].Rule != "login_failing" {
+		t.Fatalf("events = %+v, want one login_failing alert", notifier.events)
+	}
+	if states := engine.States(); !states[0].Firing || states[1].Firing {
+		t.Fatalf("states = %+v, want only login_failing firing", states)
+	}
+}
+
+func TestRulesHoldOnOfflineOrStaleSamples(t *testing.T) {
+	notifier := &recordingNotifier{}
+	engine := NewEngine([]Rule{BatteryLowRule(10, 15, 10*time.Minute), PVZeroRule(11*time.Hour, 14*time.Hour, 10*time.Minute)},
+		[]Notifier{notifier}, func() solarweb.Status { return solarweb.Status{} }, 15*time.Minute)
+
+	// An offline system reports no production and a state of charge of 0
+	noon := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	for minute := range 15 {
+		engine.ObservePower(noon.Add(time.Duration(minute)*time.Minute), solarweb.CompareData{})
+	}
+	// The last sample of an online system turns stale before the duration of
+	// the rules has passed
+	engine.ObservePower(noon.Add(15*time.Minute), solarweb.CompareData{IsOnline: true, AllOnline: true, BatteryPercentage: 5})
+	engine.Evaluate(noon.Add(45 * time.Minute))
+	engine.Close()
+	if len(notifier.events) != 0 {
+		t.Fatalf("events = %+v, want none", notifier.events)
+	}
+	if states := engine.States(); states[0].Firing || states[1].Firing {
+		t.Fatalf("states = %+v, want none firing", states)
+	}
+}
+
+func TestWebhookAndNtfyNotifiers(t *testing.T) {
+	var webhookEvent Event
+	var ntfyBody string
+	var ntfyHeader http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/webhook":
+			_ = json.NewDecoder(r.Body).Decode(&webhookEvent)
+		case "/solar":
+			body, _ := io.ReadAll(r.Body)
+			ntfyBody, ntfyHeader = string(body), r.Header
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	event := Event{Rule: "offline", Firing: true, Message: "PV system is offline", Time: time.Now()}
+	if err := NewWebhookNotifier(server.URL+"/webhook").Notify(context.Background(), event); err != nil {
+		t.Fatalf("webhook Notify returned error: %v", err)
+	}
+	if webhookEvent.Rule != "offline" || !webhookEvent.Firing {
+		t.Fatalf("webhook received %+v", webhookEvent)
+	}
+
+	if err := NewNtfyNotifier(server.URL+"/solar", "secret").Notify(context.Background(), event); err != nil {
+		t.Fatalf("ntfy Notify returned error: %v", err)
+	}
+	if ntfyBody != event.Message || ntfyHeader.Get("Priority") != "high" || ntfyHeader.Get("Authorization") != "Bearer secret" {
+		t.Fatalf("ntfy received body %q and headers %v", ntfyBody, ntfyHeader)
+	}
+
+	if err := NewWebhookNotifier(server.URL+"/missing").Notify(context.Background(), event); err == nil {
+		t.Fatal("webhook Notify succeeded for 404 response")
+	}
+}
+
+func TestSMTPNotifier(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	received := make(chan string, 1)
+	go serveSMTP(t, listener, received)
+
+	notifier := NewSMTPNotifier(mail.Config{
+		Addr: listener.Addr().String(),
+		From: "solarizer@example.com",
+		To:   []string{"admin@example.com"},
+	})
+	event := Event{Rule: "battery_low", Firing: true, Message: "Battery state of charge is 5 %", Time: time.Now()}
+	if err := notifier.Notify(context.Background(), event); err != nil {
+		t.Fatalf("Notify returned error: %v", err)
+	}
+	mail := <-received
+	if !strings.Contains(mail, "Subject: [solarizer] Alert battery_low") || !strings.Contains(mail, event.Message) {
+		t.Fatalf("mail = %q", mail)
+	}
+}
+
+// serveSMTP accepts one mail like a minimal SMTP server.
+func serveSMTP(t *testing.T, listener net.Listener, received chan<- string) {
+	conn, err := listener.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	reply := func(line string) { _, _ = conn.Write([]byte(line + "\r\n")) }
+	reply("220 localhost ESMTP")
+	var data strings.Builder
+	inData := false
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		if inData {
+			if line == ".\r\n" {
+				inData = false
+				received <- data.String()
+				reply("250 OK")
+				continue
+			}
+			data.WriteString(line)
+			continue
+		}
+		switch command := strings.ToUpper(strings.TrimSpace(line)); {
+		case strings.HasPrefix(command, "EHLO"), strings.HasPrefix(command, "HELO"):
+			reply("250 localhost")
+		case command == "DATA":
+			inData = true
+			reply("354 End data with <CR><LF>.<CR><LF>")
+		case command == "QUIT":
+			reply("221 Bye")
+			return
+		default:
+			reply("250 OK")
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package alert
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"solarizer/mail"
+	"strings"
+	"time"
+)
+
+// WebhookNotifier posts the event as JSON to a URL.
+type WebhookNotifier struct {
+	url    string
+	client *http.Client
+}
+
+func NewWebhookNotifier(url string) *WebhookNotifier {
+	return &WebhookNotifier{url: url, client: &http.Client{}}
+}
+
+func (n *WebhookNotifier) Name() string {
+	return "webhook"
+}
+
+func (n *WebhookNotifier) Notify(ctx context.Context, event Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return send(n.client, req)
+}
+
+// NtfyNotifier publishes the event to an ntfy topic, e.g.
+// https://ntfy.sh/my-solar-alerts. The message is the body, title, priority
+// and tags are set as headers.
+type NtfyNotifier struct {
+	url    string
+	token  string // optional access token
+	client *http.Client
+}
+
+func NewNtfyNotifier(url string, token string) *NtfyNotifier {
+	return &NtfyNotifier{url: url, token: token, client: &http.Client{}}
+}
+
+func (n *NtfyNotifier) Name() string {
+	return "ntfy"
+}
+
+func (n *NtfyNotifier) Notify(ctx context.Context, event Event) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.url, strings.NewReader(event.Message))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Title", title(event))
+	if event.Firing {
+		req.Header.Set("Priority", "high")
+		req.Header.Set("Tags", "warning")
+	} else {
+		req.Header.Set("Priority", "default")
+		req.Header.Set("Tags", "white_check_mark")
+	}
+	if n.token != "" {
+		req.Header.Set("Authorization", "Bearer "+n.token)
+	}
+	return send(n.client, req)
+}
+
+// SMTPNotifier sends the event as plain text mail.
+type SMTPNotifier struct {
+	config mail.Config
+}
+
+func NewSMTPNotifier(config mail.Config) *SMTPNotifier {
+	return &SMTPNotifier{config: config}
+}
+
+func (n *SMTPNotifier) Name() string {
+	return "smtp"
+}
+
+func (n *SMTPNotifier) Notify(ctx context.Context, event Event) error {
+	return mail.Send(ctx, n.config, mail.Message{
+		Subject:     title(event),
+		ContentType: "text/plain; charset=utf-8",
+		Date:        event.Time,
+		Body:        fmt.Sprintf("%s\n\nRule: %s\nTime: %s\n", event.Message, event.Rule, event.Time.Format(time.RFC3339)),
+	})
+}
+
+func title(event Event) string {
+	if event.Firing {
+		return "[solarizer] Alert " + event.Rule
+	}
+	return "[solarizer] Resolved " + event.Rule
+}
+
+func send(client *http.Client, req *http.Request) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("unexpected status %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
@@ -0,0 +1,168 @@
+package alert
+
+import (
+	"fmt"
+	"solarizer/anomaly"
+	"solarizer/solarweb"
+	"strings"
+	"time"
+)
+
+// Input is the data the rules are evaluated on.
+type Input struct {
+	Time       time.Time
+	Sample     *solarweb.CompareData // last power sample, nil if none was imported yet
+	SampleTime time.Time
+	Stale      bool // no sample within the stale duration
+	SolarWeb   solarweb.Status
+}
+
+// current reports whether the last sample is recent and from an online
+// system, so its values are meaningful.
+func (in Input) current() bool {
+	return in.Sample != nil && in.Sample.IsOnline && !in.Stale
+}
+
+// condition is the result of a rule check. Between trigger and clear, e.g.
+// for a state of charge between the two thresholds, the alert keeps its
+// state.
+type condition int
+
+const (
+	hold condition = iota
+	trigger
+	clear
+)
+
+// Rule fires once its trigger condition has held for the duration For and
+// resolves once its clear condition is met.
+type Rule struct {
+	Name  string
+	For   time.Duration
+	check func(in Input) (condition, string)
+}
+
+// OfflineRule fires if the inverter or one of the devices is reported offline.
+func OfflineRule(duration time.Duration) Rule {
+	return Rule{
+		Name: "offline",
+		For:  duration,
+		check: func(in Input) (condition, string) {
+			switch {
+			case in.Sample == nil:
+				return hold, ""
+			case !in.Sample.IsOnline:
+				return trigger, "PV system is offline"
+			case !in.Sample.AllOnline:
+				return trigger, "Not all devices of the PV system are online"
+			default:
+				return clear, "PV system is online"
+			}
+		},
+	}
+}
+
+// BatteryLowRule fires if the state of charge drops below the threshold
+// and resolves once it reaches the clear threshold. It holds while the system
+// is offline or the data is stale.
+func BatteryLowRule(below float64, clearAt float64, duration time.Duration) Rule {
+	return Rule{
+		Name: "battery_low",
+		For:  duration,
+		check: func(in Input) (condition, string) {
+			switch {
+			case !in.current():
+				return hold, ""
+			case in.Sample.BatteryPercentage < below:
+				return trigger, fmt.Sprintf("Battery state of charge is %.0f %%, below %.0f %%", in.Sample.BatteryPercentage, below)
+			case in.Sample.BatteryPercentage >= clearAt:
+				return clear, fmt.Sprintf("Battery state of charge is %.0f %%", in.Sample.BatteryPercentage)
+			default:
+				return hold, ""
+			}
+		},
+	}
+}
+
+// PVZeroRule fires if there is no PV production within the daily window,
+// given as offsets from midnight in local time. It holds while the system is
+// offline or the data is stale, the offline rule covers these.
+func PVZeroRule(start time.Duration, end time.Duration, duration time.Duration) Rule {
+	return Rule{
+		Name: "pv_zero",
+		For:  duration,
+		check: func(in Input) (condition, string) {
+			if !in.current() {
+				return hold, ""
+			}
+			t := in.SampleTime
+			offset := t.Sub(time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location()))
+			switch {
+			case in.Sample.Flow().Production > 0:
+				return clear, fmt.Sprintf("PV produces %.0f W", in.Sample.Flow().Production)
+			case offset >= start && offset < end:
+				return trigger, "PV produces nothing around midday"
+			default:
+				return hold, ""
+			}
+		},
+	}
+}
+
+// LoginFailingRule fires after the given number of consecutive failed logins
+// to SolarWeb.
+func LoginFailingRule(failures int) Rule {
+	return Rule{
+		Name: "login_failing",
+		check: func(in Input) (condition, string) {
+			if in.SolarWeb.LoginFailures >= failures {
+				return trigger, fmt.Sprintf("Login to SolarWeb failed %d times: %s", in.SolarWeb.LoginFailures, in.SolarWeb.LastLoginError)
+			}
+			if in.SolarWeb.LoginFailures == 0 {
+				return clear, "Login to SolarWeb succeeded"
+			}
+			return hold, ""
+		},
+	}
+}
+
+// ProductionAnomalyRule fires if the last finished day produced far less than
+// comparable days, overall or in some hours, and resolves with the next normal
+// day.
+func ProductionAnomalyRule(detector *anomaly.Detector) Rule {
+	return Rule{
+		Name: "production_anomaly",
+		check: func(in Input) (condition, string) {
+			latest := detector.Latest()
+			switch {
+			case latest == nil || latest.Expected == 0:
+				return hold, "" // not enough comparable days
+			case latest.Anomalous:
+				return trigger, latest.Message()
+			default:
+				return clear, latest.Message()
+			}
+		},
+	}
+}
+
+// ParseDailyWindow parses a window in the format "HH:MM-HH:MM" into offsets
+// from midnight.
+func ParseDailyWindow(value string) (time.Duration, time.Duration, error) {
+	from, to, ok := strings.Cut(value, "-")
+	if !ok {
+		return 0, 0, fmt.Errorf("invalid window %q, expected HH:MM-HH:MM", value)
+	}
+	var offsets [2]time.Duration
+	for i, clock := range []string{from, to} {
+		t, err := time.Parse("15:04", strings.TrimSpace(clock))
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid time %q, expected HH:MM", clock)
+		}
+		offsets[i] = time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute
+	}
+	if offsets[0] >= offsets[1] {
+		return 0, 0, fmt.Errorf("invalid window %q, start must be before end", value)
+	}
+	return offsets[0], offsets[1], nil
+}
@@ -0,0 +1,324 @@
+package anomaly
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"solarizer/energy"
+	"solarizer/solarweb"
+	"solarizer/statefile"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/log"
+	influxdb2 "github.com/influxdata/influxdb-client-go/v2"
+	"github.com/influxdata/influxdb-client-go/v2/api/write"
+)
+
+const (
+	// maxDays is the number of days kept for comparison, a bit more than a
+	// year so the same season of the last year is available
+	maxDays = 400
+	// maxAnomalies is the number of anomalies kept
+	maxAnomalies = 100
+	// seasonWindow is the distance in days of year of comparable days
+	seasonWindow = 21
+	// minComparable is the number of comparable days needed for an evaluation
+	minComparable = 5
+	// minHourShare is the share of the production of the best hour an hour
+	// must expect to be evaluated, hours at dawn and dusk are too noisy
+	minHourShare = 0.1
+	// weatherInterval is the interval the weather condition is polled in
+	weatherInterval = 15 * time.Minute
+	// minCoverage is the share of a day that must be covered by counted
+	// intervals, days with longer gaps are neither evaluated nor compared
+	minCoverage = 0.95
+)
+
+// Day is the production of a day in Wh.
+type Day struct {
+	Date       string        `json:"date"` // "2006-01-02"
+	Production float64       `json:"production"`
+	Hours      [24]float64   `json:"hours"`
+	Condition  string        `json:"condition"`  // prevailing weather condition, "" if unknown
+	Covered    time.Duration `json:"covered"`    // counted intervals, while recording
+	Incomplete bool          `json:"incomplete"` // less than minCoverage was counted
+}
+
+// Anomaly is a day or an hour that produced far less than comparable days.
+type Anomaly struct {
+	Start      time.Time `json:"start"`
+	End        time.Time `json:"end"`
+	Production float64   `json:"production"` // Wh
+	Expected   float64   `json:"expected"`   // median production of the comparable days in Wh
+	Ratio      float64   `json:"ratio"`
+	Condition  string    `json:"condition"`
+}
+
+// Evaluation is the result of comparing a day with comparable days, i.e. days
+// of the same season with the same weather condition.
+type Evaluation struct {
+	Date       string    `json:"date"`
+	Comparable int       `json:"comparable"` // no evaluation below minComparable
+	Production float64   `json:"production"`
+	Expected   float64   `json:"expected"`
+	Ratio      float64   `json:"ratio"`
+	Condition  string    `json:"condition"`
+	Incomplete bool      `json:"incomplete"` // not evaluated, the data of the day has gaps
+	Anomalous  bool      `json:"anomalous"`  // the day or one of its hours
+	Anomalies  []Anomaly `json:"anomalies"`
+}
+
+// detectorState is persisted after every sample.
+type detectorState struct {
+	Last       time.Time          `json:"last"`
+	PV         float64            `json:"pv"` // PV counter at Last
+	Today      Day                `json:"today"`
+	Conditions map[string]float64 `json:"conditions"` // production of today per weather condition
+	Days       []Day              `json:"days"`       // oldest first
+	Anomalies  []Anomaly          `json:"anomalies"`  // oldest first
+	Latest     *Evaluation        `json:"latest"`
+}
+
+// Detector records the hourly production and compares every finished day
+// with comparable days to detect soiling, shading or failed strings. It
+// implements influx.PowerObserver.
+type Detector struct {
+	threshold  float64 // ratio of the expected production below which a day or hour is anomalous
+	integrator *energy.Integrator
+	weather    *solarweb.SolarWeb // optional, days of all weathers are compared without
+	filename   string             // optional, state is not persisted if empty
+
+	mu        sync.Mutex
+	condition string // current weather condition
+	state     detectorState
+}
+
+// NewDetector creates a detector that persists its state in filename and
+// continues with the days found there.
+func NewDetector(threshold float64, integrator *energy.Integrator, weather *solarweb.SolarWeb, filename string) (*Detector, error) {
+	d := &Detector{threshold: threshold, integrator: integrator, weather: weather, filename: filename}
+	if filename != "" {
+		restored, err := statefile.Load(filename, &d.state)
+		if err != nil {
+			return nil, err
+		}
+		if restored {
+			log.Info("Restored production history", "days", len(d.state.Days))
+		}
+	}
+	if d.state.Conditions == nil {
+		d.state.Conditions = make(map[string]float64)
+	}
+	return d, nil
+}
+
+// Run polls the weather condition until ctx is cancelled.
+func (d *Detector) Run(ctx context.Context) {
+	if d.weather == nil {
+		return
+	}
+	ticker := time.NewTicker(weatherInterval)
+	defer ticker.Stop()
+	for {
+		widget, err := d.weather.GetWeatherWidgetData(ctx)
+		if err != nil && ctx.Err() == nil {
+			log.Warn("Error fetching weather", "err", err)
+		} else if err == nil {
+			d.mu.Lock()
+			d.condition = widget.Condition()
+			d.mu.Unlock()
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// ObservePower adds the production since the last sample to the hour of the
+// last sample. The first sample of a day finishes the previous day and returns
+// its evaluation as measurement "anomaly".
+func (d *Detector) ObservePower(now time.Time, _ solarweb.CompareData) []*write.Point {
+	counters, ok := d.integrator.CountersAt(now)
+	if !ok {
+		return nil
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	st := &d.state
+	if delta := counters.Total.PV - st.PV; !st.Last.IsZero() && now.Sub(st.Last) <= energy.MaxGap && delta >= 0 {
+		st.Today.Production += delta
+		st.Today.Hours[st.Last.Hour()] += delta
+		st.Today.Covered += now.Sub(st.Last)
+		st.Conditions[d.condition] += delta
+	}
+	st.Last, st.PV = now, counters.Total.PV
+
+	var points []*write.Point
+	if date := now.Format(time.DateOnly); st.Today.Date != date {
+		if st.Today.Date != "" {
+			points = append(points, d.finish(now))
+		}
+		st.Today = Day{Date: date}
+		clear(st.Conditions)
+	}
+	if d.filename != "" {
+		if err := statefile.Save(d.filename, st); err != nil {
+			log.Error("Unable to persist production history", "err", err)
+		}
+	}
+	return points
+}
+
+// Latest returns the evaluation of the last finished day, nil if there is
+// none.
+func (d *Detector) Latest() *Evaluation {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.state.Latest
+}
+
+// Anomalies returns the detected anomalies, newest first.
+func (d *Detector) Anomalies() []Anomaly {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	anomalies := make([]Anomaly, len(d.state.Anomalies))
+	copy(anomalies, d.state.Anomalies)
+	slices.Reverse(anomalies)
+	return anomalies
+}
+
+// finish evaluates today and adds it to the days.
+func (d *Detector) finish(now time.Time) *write.Point {
+	st := &d.state
+	day := st.Today
+	if len(st.Conditions) > 0 {
+		day.Condition = slices.MaxFunc(slices.Sorted(maps.Keys(st.Conditions)), func(a, b string) int {
+			return cmp.Compare(st.Conditions[a], st.Conditions[b])
+		})
+	}
+	start, err := time.ParseInLocation(time.DateOnly, day.Date, now.Location())
+	if err != nil {
+		start = now // not reached, the date is formatted by ObservePower
+	}
+	day.Incomplete = day.Covered.Seconds() < minCoverage*start.AddDate(0, 0, 1).Sub(start).Seconds()
+
+	evaluation := Evaluate(day, start, st.Days, d.threshold)
+	st.Latest = &evaluation
+	st.Anomalies = append(st.Anomalies, evaluation.Anomalies...)
+	if len(st.Anomalies) > maxAnomalies {
+		st.Anomalies = st.Anomalies[len(st.Anomalies)-maxAnomalies:]
+	}
+	st.Days = append(st.Days, day)
+	if len(st.Days) > maxDays {
+		st.Days = st.Days[len(st.Days)-maxDays:]
+	}
+	if day.Incomplete {
+		log.Info("Production of day not evaluated, data has gaps", "date", day.Date, "covered", day.Covered)
+	}
+	if evaluation.Anomalous {
+		log.Warn("Production anomaly detected", "date", day.Date, "production", day.Production, "expected", evaluation.Expected, "anomalies", len(evaluation.Anomalies))
+	}
+
+	return influxdb2.NewPointWithMeasurement("anomaly").
+		AddField("production", evaluation.Production).
+		AddField("expected", evaluation.Expected).
+		AddField("ratio", evaluation.Ratio).
+		AddField("comparable", evaluation.Comparable).
+		AddField("anomalies", len(evaluation.Anomalies)).
+		AddField("incomplete", evaluation.Incomplete).
+		SetTime(now)
+}
+
+// Evaluate compares the day starting at start with the comparable days. The
+// day and each of its hours is anomalous if it produced less than threshold
+// times the median of the comparable days. Incomplete days are skipped.
+func Evaluate(day Day, start time.Time, days []Day, threshold float64) Evaluation {
+	e := Evaluation{Date: day.Date, Production: day.Production, Condition: day.Condition, Incomplete: day.Incomplete}
+	if day.Incomplete {
+		return e
+	}
+	var comparable []Day
+	for _, other := range days {
+		if !other.Incomplete && other.Date != day.Date && (day.Condition == "" || other.Condition == day.Condition) && sameSeason(day.Date, other.Date) {
+			comparable = append(comparable, other)
+		}
+	}
+	e.Comparable = len(comparable)
+	if e.Comparable < minComparable {
+		return e
+	}
+
+	e.Expected = median(comparable, func(d Day) float64 { return d.Production })
+	if e.Expected > 0 {
+		e.Ratio = day.Production / e.Expected
+	}
+	if e.Expected > 0 && e.Ratio < threshold {
+		e.Anomalies = append(e.Anomalies, Anomaly{
+			Start: start, End: start.AddDate(0, 0, 1),
+			Production: day.Production, Expected: e.Expected, Ratio: e.Ratio, Condition: day.Condition,
+		})
+	}
+
+	var expected [24]float64
+	for hour := range expected {
+		expected[hour] = median(comparable, func(d Day) float64 { return d.Hours[hour] })
+	}
+	best := slices.Max(expected[:])
+	for hour, production := range day.Hours {
+		if best == 0 || expected[hour] < minHourShare*best || production >= threshold*expected[hour] {
+			continue
+		}
+		hourStart := start.Add(time.Duration(hour) * time.Hour)
+		e.Anomalies = append(e.Anomalies, Anomaly{
+			Start: hourStart, End: hourStart.Add(time.Hour),
+			Production: production, Expected: expected[hour], Ratio: production / expected[hour], Condition: day.Condition,
+		})
+	}
+	e.Anomalous = len(e.Anomalies) > 0
+	return e
+}
+
+// Message describes the evaluation.
+func (e *Evaluation) Message() string {
+	switch {
+	case !e.Anomalous:
+		return fmt.Sprintf("Production of %s is normal", e.Date)
+	case e.Anomalies[0].End.Sub(e.Anomalies[0].Start) > time.Hour: // the whole day
+		return fmt.Sprintf("Production of %s is %.0f %% of comparable days", e.Date, e.Ratio*100)
+	default:
+		return fmt.Sprintf("Production of %s is far below comparable days in %d hours", e.Date, len(e.Anomalies))
+	}
+}
+
+// sameSeason reports whether the days of year of two dates are within the
+// season window, across the turn of the year.
+func sameSeason(a string, b string) bool {
+	ta, errA := time.Parse(time.DateOnly, a)
+	tb, errB := time.Parse(time.DateOnly, b)
+	if errA != nil || errB != nil {
+		return false
+	}
+	distance := ta.YearDay() - tb.YearDay()
+	if distance < 0 {
+		distance = -distance
+	}
+	return min(distance, 365-distance) <= seasonWindow
+}
+
+func median(days []Day, value func(Day) float64) float64 {
+	values := make([]float64, len(days))
+	for i, day := range days {
+		values[i] = value(day)
+	}
+	slices.Sort(values)
+	if n := len(values); n%2 == 0 {
+		return (values[n/2-1] + values[n/2]) / 2
+	}
+	return values[len(values)/2]
+}
@@ -0,0 +1,132 @@
+package anomaly
+
+import (
+	"solarizer/energy"
+	"solarizer/solarweb"
+	"testing"
+	"time"
+
+	"github.com/influxdata/influxdb-client-go/v2/api/write"
+)
+
+// sunnyDay produces 1 kWh per hour from 8:00 to 17:00.
+func sunnyDay(date string) Day {
+	day := Day{Date: date, Condition: "sunny"}
+	for hour := 8; hour < 18; hour++ {
+		day.Hours[hour] = 1000
+		day.Production += 1000
+	}
+	return day
+}
+
+func TestEvaluate(t *testing.T) {
+	var days []Day
+	for _, date := range []string{"2024-06-10", "2024-06-20", "2025-05-25", "2025-06-01", "2025-06-02", "2025-06-03"} {
+		days = append(days, sunnyDay(date))
+	}
+	// Comparable by season, but with a different weather or out of season
+	cloudy := Day{Date: "2025-06-04", Condition: "cloudy", Production: 2000}
+	days = append(days, cloudy, sunnyDay("2025-01-10"))
+	start := time.Date(2025, 6, 5, 0, 0, 0, 0, time.UTC)
+
+	normal := Evaluate(sunnyDay("2025-06-05"), start, days, 0.6)
+	if normal.Comparable != 6 || normal.Expected != 10000 || normal.Anomalous {
+		t.Fatalf("normal day = %+v, want 6 comparable days and no anomaly", normal)
+	}
+
+	// A failed string halves the production from 12:00
+	failing := sunnyDay("2025-06-05")
+	for hour := 12; hour < 18; hour++ {
+		failing.Hours[hour] = 400
+		failing.Production -= 600
+	}
+	e := Evaluate(failing, start, days, 0.6)
+	if !e.Anomalous || len(e.Anomalies) != 6 || !e.Anomalies[0].Start.Equal(start.Add(12*time.Hour)) {
+		t.Fatalf("failing day = %+v, want six anomalous hours from 12:00", e)
+	}
+
+	soiled := sunnyDay("2025-06-05")
+	for hour := 8; hour < 18; hour++ {
+		soiled.Hours[hour] = 500
+	}
+	soiled.Production = 5000
+	e = Evaluate(soiled, start, days, 0.6)
+	if !e.Anomalous || e.Ratio != 0.5 || !e.Anomalies[0].End.Equal(start.AddDate(0, 0, 1)) {
+		t.Fatalf("soiled day = %+v, want the whole day anomalous", e)
+	}
+	if msg := e.Message(); msg != "Production of 2025-06-05 is 50 % of comparable days" {
+		t.Fatalf("message = %q", msg)
+	}
+
+	// Incomplete days are neither evaluated nor compared
+	incomplete := soiled
+	incomplete.Incomplete = true
+	if e := Evaluate(incomplete, start, days, 0.6); !e.Incomplete || e.Anomalous {
+		t.Fatalf("incomplete day = %+v, want no evaluation", e)
+	}
+	days[0].Incomplete = true
+	if e := Evaluate(sunnyDay("2025-06-05"), start, days, 0.6); e.Comparable != 5 {
+		t.Fatalf("day = %+v, want 5 comparable days without the incomplete one", e)
+	}
+	days[0].Incomplete = false
+
+	// The cloudy day has no comparable days
+	if e := Evaluate(cloudy, start, days, 0.6); e.Comparable != 0 || e.Anomalous {
+		t.Fatalf("cloudy day = %+v, want no evaluation", e)
+	}
+}
+
+func TestDetectorFinishesDays(t *testing.T) {
+	integrator, err := energy.Open("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	detector, err := NewDetector(0.6, integrator, nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range 5 {
+		detector.state.Days = append(detector.state.Days, sunnyDay(time.Date(2025, 6, 1+i, 0, 0, 0, 0, time.UTC).Format(time.DateOnly)))
+		detector.state.Days[i].Condition = ""
+	}
+
+	// A sample every 5 minutes, 1.2 kW from 12:00 to 13:00 only
+	day := time.Date(2025, 6, 6, 0, 0, 0, 0, time.UTC)
+	noon := day.Add(12 * time.Hour)
+	observe := func(from time.Time, to time.Time) []*write.Point {
+		var points []*write.Point
+		for now := from; !now.After(to); now = now.Add(5 * time.Minute) {
+			data := solarweb.CompareData{}
+			if !now.Before(noon) && !now.After(noon.Add(time.Hour)) {
+				data.PowerPV = 1200
+			}
+			integrator.ObservePower(now, data)
+			points = append(points, detector.ObservePower(now, data)...)
+		}
+		return points
+	}
+	if points := observe(day, day.AddDate(0, 0, 1)); len(points) != 1 {
+		t.Fatalf("ObservePower returned %d points, want the evaluation at midnight", len(points))
+	}
+
+	// Ramping up before 12:00 and down after 13:00 adds 50 Wh each
+	latest := detector.Latest()
+	if latest == nil || latest.Date != "2025-06-06" || latest.Production != 1300 || latest.Incomplete || !latest.Anomalous {
+		t.Fatalf("latest = %+v, want anomalous 2025-06-06 with 1300 Wh", latest)
+	}
+	if anomalies := detector.Anomalies(); len(anomalies) != 10 || !anomalies[0].Start.Equal(noon.Add(5*time.Hour)) {
+		t.Fatalf("anomalies = %+v, want the day and 9 hours newest first", anomalies)
+	}
+
+	// The next day is only recorded around noon, e.g. due to a SolarWeb outage
+	day, noon = day.AddDate(0, 0, 1), noon.AddDate(0, 0, 1)
+	observe(noon.Add(-time.Hour), noon.Add(2*time.Hour))
+	observe(day.AddDate(0, 0, 1), day.AddDate(0, 0, 1))
+	latest = detector.Latest()
+	if latest == nil || latest.Date != "2025-06-07" || !latest.Incomplete || latest.Anomalous {
+		t.Fatalf("latest = %+v, want incomplete 2025-06-07 without evaluation", latest)
+	}
+	if anomalies := detector.Anomalies(); len(anomalies) != 10 {
+		t.Fatalf("%d anomalies, want no new ones", len(anomalies))
+	}
+}
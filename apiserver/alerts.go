@@ -0,0 +1,29 @@
+package apiserver
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/charmbracelet/log"
+)
+
+// getAlerts returns the state of all alert rules.
+func (s *ApiServer) getAlerts(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err, status := s.validateApiToken(r); err != nil {
+		log.Warn("Error validating API token", "err", err)
+		http.Error(w, "", status)
+		return
+	}
+	log.Debug("Received getAlerts request")
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(s.alerts.States())
+	if err != nil {
+		log.Error("Error encoding to JSON", "err", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,40 @@
+package apiserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"solarizer/anomaly"
+
+	"github.com/charmbracelet/log"
+)
+
+type anomalies struct {
+	Latest    *anomaly.Evaluation `json:"latest"`
+	Anomalies []anomaly.Anomaly   `json:"anomalies"`
+}
+
+// getAnomalies returns the evaluation of the last finished day and the
+// detected anomalies, newest first.
+func (s *ApiServer) getAnomalies(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err, status := s.validateApiToken(r); err != nil {
+		log.Warn("Error validating API token", "err", err)
+		http.Error(w, "", status)
+		return
+	}
+	log.Debug("Received getAnomalies request")
+	data := anomalies{
+		Latest:    s.anomalies.Latest(),
+		Anomalies: s.anomalies.Anomalies(),
+	}
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(data)
+	if err != nil {
+		log.Error("Error encoding to JSON", "err", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
@@ -7,8 +7,21 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/netip"
 	"os"
+	"solarizer/alert"
+	"solarizer/anomaly"
+	"solarizer/availability"
+	"solarizer/battery"
+	"solarizer/energy"
+	"solarizer/forecast"
+	"solarizer/history"
+	"solarizer/influx"
+	"solarizer/kpi"
+	"solarizer/loadcontrol"
+	"solarizer/report"
 	"solarizer/solarweb"
+	"solarizer/tariff"
 	"strings"
 
 	"github.com/charmbracelet/log"
@@ -18,9 +31,42 @@ type ApiServer struct {
 	server         *http.Server
 	apiTokens      map[string]bool
 	solarWebClient *solarweb.SolarWeb
+	importer       *influx.Importer
+	history        history.Source
+	kpi            *kpi.Tracker
+	energy         *energy.Integrator
+	costs          *tariff.Calculator
+	prices         *tariff.PriceFeed
+	alerts         *alert.Engine
+	availability   *availability.Tracker
+	reports        *report.Reporter
+	forecast       *forecast.Forecaster
+	battery        *battery.Tracker
+	anomalies      *anomaly.Detector
+	loads          *loadcontrol.Controller
+	meterNetworks  []netip.Prefix // may query the meters without API token
+	meterCache     meterCache
 }
 
-func New(addr string, solarWebClient *solarweb.SolarWeb) *ApiServer {
+// Backends are the optional services exposed by the API server. Endpoints of
+// backends that are nil are not registered.
+type Backends struct {
+	Importer     *influx.Importer        // reports the readiness and metrics of the sinks
+	History      history.Source          // answers history queries
+	KPI          *kpi.Tracker            // computes the KPIs of the imported power data
+	Energy       *energy.Integrator      // integrates the imported power data
+	Costs        *tariff.Calculator      // prices the integrated energy
+	Prices       *tariff.PriceFeed       // provides dynamic prices, requires Costs
+	Alerts       *alert.Engine           // evaluates the alert rules
+	Availability *availability.Tracker   // detects outages and frozen data
+	Reports      *report.Reporter        // compiles daily and monthly reports
+	Forecast     *forecast.Forecaster    // forecasts the production
+	Battery      *battery.Tracker        // interprets the battery power and state of charge
+	Anomalies    *anomaly.Detector       // detects days and hours of low production
+	Loads        *loadcontrol.Controller // switches loads by the surplus
+}
+
+func New(addr string, solarWebClient *solarweb.SolarWeb, backends Backends) *ApiServer {
 	// Create server
 	mux := http.NewServeMux()
 
@@ -33,14 +79,70 @@ func New(addr string, solarWebClient *solarweb.SolarWeb) *ApiServer {
 		server:         server,
 		apiTokens:      make(map[string]bool),
 		solarWebClient: solarWebClient,
+		importer:       backends.Importer,
+		history:        backends.History,
+		kpi:            backends.KPI,
+		energy:         backends.Energy,
+		costs:          backends.Costs,
+		prices:         backends.Prices,
+		alerts:         backends.Alerts,
+		availability:   backends.Availability,
+		reports:        backends.Reports,
+		forecast:       backends.Forecast,
+		battery:        backends.Battery,
+		anomalies:      backends.Anomalies,
+		loads:          backends.Loads,
 	}
 
+	mux.HandleFunc("/healthz", s.getHealthz)
+	mux.HandleFunc("/readyz", s.getReadyz)
+	mux.HandleFunc("/metrics", s.getMetrics)
 	mux.HandleFunc("/api/auth/cookie", s.putAuthCookie)
 	mux.HandleFunc("/api/pv/power", s.getPowerData)
 	mux.HandleFunc("/api/pv/production", s.getProductionsAndEarnings)
 	mux.HandleFunc("/api/pv/balance", s.getBalance)
+	mux.HandleFunc("/api/pv/meter/{meter}", s.getMeter)
+	if s.history != nil {
+		mux.HandleFunc("/api/pv/history/{measurement}", s.getHistory)
+		mux.HandleFunc("/api/pv/export", s.getExport)
+	}
+	if s.kpi != nil {
+		mux.HandleFunc("/api/pv/kpi", s.getKPI)
+	}
+	if s.energy != nil {
+		mux.HandleFunc("/api/pv/energy", s.getEnergy)
+	}
+	if s.costs != nil {
+		mux.HandleFunc("/api/pv/costs", s.getCosts)
+	}
+	if s.costs != nil && s.prices != nil {
+		mux.HandleFunc("/api/pv/prices", s.getPrices)
+		mux.HandleFunc("/api/pv/prices/cheapest", s.getCheapestPrices)
+	}
+	if s.battery != nil {
+		mux.HandleFunc("/api/pv/battery", s.getBattery)
+	}
+	if s.anomalies != nil {
+		mux.HandleFunc("/api/pv/anomalies", s.getAnomalies)
+	}
+	if s.availability != nil {
+		mux.HandleFunc("/api/pv/status", s.getStatus)
+	}
+	if s.reports != nil {
+		mux.HandleFunc("/api/pv/reports/{period}", s.getReport)
+	}
+	if s.forecast != nil {
+		mux.HandleFunc("/api/pv/forecast", s.getForecast)
+	}
+	if s.loads != nil {
+		mux.HandleFunc("/api/pv/loads", s.getLoads)
+	}
+	if s.alerts != nil {
+		mux.HandleFunc("/api/pv/alerts", s.getAlerts)
+	}
 
 	s.initApiTokens()
+	s.initMeterNetworks()
 
 	return s
 }
@@ -111,14 +213,14 @@ func (s *ApiServer) getPowerData(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	log.Debug("Received getPowerData request")
-	data, err := s.solarWebClient.GetCompareData()
+	data, err := s.solarWebClient.GetCompareData(r.Context())
 	if err != nil {
 		log.Error("Error requesting power data", "err", err)
 		http.Error(w, err.Error(), http.StatusBadGateway)
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
-	err = json.NewEncoder(w).Encode(data)
+	err = json.NewEncoder(w).Encode(solarweb.NewPowerData(data))
 	if err != nil {
 		log.Error("Error encoding to JSON", "err", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -136,7 +238,7 @@ func (s *ApiServer) getProductionsAndEarnings(w http.ResponseWriter, r *http.Req
 		return
 	}
 	log.Debug("Received getProductionsAndEarnings request")
-	data, err := s.solarWebClient.GetProductionsAndEarnings()
+	data, err := s.solarWebClient.GetProductionsAndEarnings(r.Context())
 	if err != nil {
 		log.Error("Error requesting earnings data", "err", err)
 		http.Error(w, err.Error(), http.StatusBadGateway)
@@ -161,7 +263,7 @@ func (s *ApiServer) getBalance(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	log.Debug("Received getBalance request")
-	data, err := s.solarWebClient.GetWidgetChart()
+	data, err := s.solarWebClient.GetWidgetChart(r.Context())
 	if err != nil {
 		log.Error("Error requesting balance data", "err", err)
 		http.Error(w, err.Error(), http.StatusBadGateway)
@@ -175,3 +277,14 @@ func (s *ApiServer) getBalance(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 }
+
+// writeJSON encodes data as JSON response.
+func writeJSON(w http.ResponseWriter, data any) {
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(data)
+	if err != nil {
+		log.Error("Error encoding to JSON", "err", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
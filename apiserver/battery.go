@@ -0,0 +1,34 @@
+package apiserver
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/charmbracelet/log"
+)
+
+// getBattery returns the battery statistics and the monthly capacity trend.
+func (s *ApiServer) getBattery(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err, status := s.validateApiToken(r); err != nil {
+		log.Warn("Error validating API token", "err", err)
+		http.Error(w, "", status)
+		return
+	}
+	log.Debug("Received getBattery request")
+	data := s.battery.Stats()
+	if data.Time.IsZero() {
+		http.Error(w, "No power data imported yet", http.StatusServiceUnavailable)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(data)
+	if err != nil {
+		log.Error("Error encoding to JSON", "err", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
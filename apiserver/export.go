@@ -0,0 +1,117 @@
+package apiserver
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/url"
+	"solarizer/export"
+	"time"
+
+	"github.com/charmbracelet/log"
+)
+
+const defaultExportEvery = time.Hour
+
+type exportQuery struct {
+	From   time.Time
+	To     time.Time
+	Every  time.Duration
+	Format string
+}
+
+// getExport returns the power, production and balance series as CSV or
+// Parquet file. The query parameters from and to accept RFC 3339 timestamps
+// or dates, every accepts durations like "15m" and tz an IANA time zone name
+// used for the timestamps and bucket alignment.
+func (s *ApiServer) getExport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err, status := s.validateApiToken(r); err != nil {
+		log.Warn("Error validating API token", "err", err)
+		http.Error(w, "", status)
+		return
+	}
+	log.Debug("Received getExport request")
+	query, err := parseExportQuery(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	table, err := export.Collect(r.Context(), s.history, query.From, query.To, query.Every)
+	if err != nil {
+		log.Error("Error querying history", "err", err)
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	// Encode into a buffer first, so errors can still be reported
+	var buf bytes.Buffer
+	contentType := "text/csv; charset=utf-8"
+	if query.Format == "parquet" {
+		contentType = "application/vnd.apache.parquet"
+		err = export.WriteParquet(&buf, table)
+	} else {
+		err = export.WriteCSV(&buf, table)
+	}
+	if err != nil {
+		log.Error("Error encoding export", "err", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	filename := fmt.Sprintf("solarizer_%s_%s.%s",
+		query.From.Format(time.DateOnly), query.To.Format(time.DateOnly), query.Format)
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	_, _ = w.Write(buf.Bytes())
+}
+
+// parseExportQuery validates the query parameters. It defaults to the last
+// 24 hours in 1 hour buckets as CSV in local time.
+func parseExportQuery(values url.Values) (exportQuery, error) {
+	query := exportQuery{
+		Every:  defaultExportEvery,
+		Format: "csv",
+	}
+	loc := time.Local
+	var err error
+	if value := values.Get("tz"); value != "" {
+		if loc, err = time.LoadLocation(value); err != nil {
+			return query, fmt.Errorf("invalid parameter tz: %w", err)
+		}
+	}
+	query.To = time.Now().In(loc)
+	if value := values.Get("to"); value != "" {
+		if query.To, err = parseTimeIn(value, loc); err != nil {
+			return query, fmt.Errorf("invalid parameter to: %w", err)
+		}
+	}
+	query.From = query.To.Add(-defaultHistoryRange)
+	if value := values.Get("from"); value != "" {
+		if query.From, err = parseTimeIn(value, loc); err != nil {
+			return query, fmt.Errorf("invalid parameter from: %w", err)
+		}
+	}
+	if value := values.Get("every"); value != "" {
+		if query.Every, err = time.ParseDuration(value); err != nil {
+			return query, fmt.Errorf("invalid parameter every: %w", err)
+		}
+	}
+	if value := values.Get("format"); value != "" {
+		query.Format = value
+	}
+
+	switch {
+	case query.Format != "csv" && query.Format != "parquet":
+		return query, fmt.Errorf("invalid format %q, must be csv or parquet", query.Format)
+	case !query.From.Before(query.To):
+		return query, fmt.Errorf("from must be before to")
+	case query.Every < time.Second:
+		return query, fmt.Errorf("every must be at least 1s")
+	case query.To.Sub(query.From)/query.Every > maxHistoryPoints:
+		return query, fmt.Errorf("too many buckets, increase every")
+	}
+	return query, nil
+}
@@ -0,0 +1,62 @@
+package apiserver
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"solarizer/influx"
+	"solarizer/solarweb"
+	"time"
+
+	"github.com/charmbracelet/log"
+)
+
+const pingTimeout = 3 * time.Second
+
+type readiness struct {
+	Ready    bool            `json:"ready"`
+	SolarWeb solarweb.Status `json:"solarweb"`
+	Sinks    []influx.Status `json:"sinks,omitempty"`
+}
+
+// getHealthz reports that the process is alive. It requires no API token so
+// it can be used by container health checks.
+func (s *ApiServer) getHealthz(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain")
+	_, _ = w.Write([]byte("ok\n"))
+}
+
+// getReadyz reports whether the last SolarWeb request succeeded and all sinks
+// are reachable without recent write errors. It requires no API token so it
+// can be used by container health checks.
+func (s *ApiServer) getReadyz(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	data := readiness{
+		SolarWeb: s.solarWebClient.Status(),
+	}
+	data.Ready = data.SolarWeb.Healthy()
+	if s.importer != nil {
+		ctx, cancel := context.WithTimeout(r.Context(), pingTimeout)
+		defer cancel()
+		data.Sinks = s.importer.Status(ctx)
+		for _, sinkStatus := range data.Sinks {
+			data.Ready = data.Ready && sinkStatus.Healthy()
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if !data.Ready {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	err := json.NewEncoder(w).Encode(data)
+	if err != nil {
+		log.Error("Error encoding to JSON", "err", err)
+	}
+}
@@ -0,0 +1,84 @@
+package apiserver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"solarizer/influx"
+	"solarizer/solarweb"
+	"testing"
+
+	"github.com/influxdata/influxdb-client-go/v2/api/write"
+)
+
+// newTestServer creates a server accepting the API token "token".
+func newTestServer(t *testing.T, backends Backends) *ApiServer {
+	t.Helper()
+	t.Setenv("API_TOKENS", "token")
+	client := solarweb.New("1", filepath.Join(t.TempDir(), "authcookie"), "user", "password")
+	return New("", client, backends)
+}
+
+// fakeSink is a sink that failed to write if failing is set.
+type fakeSink struct {
+	influx.SinkState
+	failing bool
+}
+
+func (s *fakeSink) Name() string                  { return "fake" }
+func (s *fakeSink) WritePoint(point *write.Point) {}
+func (s *fakeSink) Close()                        {}
+
+func (s *fakeSink) Status(_ context.Context) influx.Status {
+	if s.failing {
+		s.RecordError(errors.New("write failed"))
+	}
+	st := s.State(s.Name())
+	st.Reachable = true
+	return st
+}
+
+func TestHealthz(t *testing.T) {
+	s := newTestServer(t, Backends{})
+	w := httptest.NewRecorder()
+	s.server.Handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if w.Code != http.StatusOK || w.Body.String() != "ok\n" {
+		t.Fatalf("GET /healthz = %d %q, want 200 ok", w.Code, w.Body.String())
+	}
+	w = httptest.NewRecorder()
+	s.server.Handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/healthz", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("POST /healthz = %d, want 405", w.Code)
+	}
+}
+
+func TestReadyz(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		backends Backends
+		want     int
+	}{
+		{"without importer and SolarWeb requests", Backends{}, http.StatusOK},
+		{"healthy sink", Backends{Importer: influx.NewImporter(nil, &fakeSink{})}, http.StatusOK},
+		{"failing sink", Backends{Importer: influx.NewImporter(nil, &fakeSink{failing: true})}, http.StatusServiceUnavailable},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, tt.backends)
+			w := httptest.NewRecorder()
+			s.server.Handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+			if w.Code != tt.want {
+				t.Fatalf("GET /readyz = %d, want %d: %s", w.Code, tt.want, w.Body.String())
+			}
+			var data readiness
+			if err := json.NewDecoder(w.Body).Decode(&data); err != nil {
+				t.Fatal(err)
+			}
+			if data.Ready != (tt.want == http.StatusOK) {
+				t.Fatalf("ready = %t, want %t", data.Ready, tt.want == http.StatusOK)
+			}
+		})
+	}
+}
@@ -0,0 +1,129 @@
+package apiserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"solarizer/history"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/log"
+)
+
+const (
+	defaultHistoryRange = 24 * time.Hour
+	defaultHistoryEvery = 5 * time.Minute
+	maxHistoryPoints    = 10000
+)
+
+type historyResponse struct {
+	Measurement string           `json:"measurement"`
+	From        time.Time        `json:"from"`
+	To          time.Time        `json:"to"`
+	Every       string           `json:"every"`
+	Series      []history.Series `json:"series"`
+}
+
+// getHistory returns the aggregated series of a measurement. The query
+// parameters from and to accept RFC 3339 timestamps or dates, every accepts
+// durations like "15m". The optional parameter field may be repeated.
+func (s *ApiServer) getHistory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err, status := s.validateApiToken(r); err != nil {
+		log.Warn("Error validating API token", "err", err)
+		http.Error(w, "", status)
+		return
+	}
+	log.Debug("Received getHistory request")
+	query, err := parseHistoryQuery(r.PathValue("measurement"), r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	series, err := s.history.Query(r.Context(), query)
+	if err != nil {
+		log.Error("Error querying history", "err", err)
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	if series == nil {
+		series = []history.Series{}
+	}
+
+	data := historyResponse{
+		Measurement: query.Measurement,
+		From:        query.From,
+		To:          query.To,
+		Every:       query.Every.String(),
+		Series:      series,
+	}
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(data)
+	if err != nil {
+		log.Error("Error encoding to JSON", "err", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// parseHistoryQuery validates the query parameters. It defaults to the last
+// 24 hours in 5 minute buckets.
+func parseHistoryQuery(measurement string, values url.Values) (history.Query, error) {
+	query := history.Query{
+		Measurement: measurement,
+		Fields:      values["field"],
+		To:          time.Now(),
+		Every:       defaultHistoryEvery,
+	}
+	var err error
+	if value := values.Get("to"); value != "" {
+		if query.To, err = parseTime(value); err != nil {
+			return query, fmt.Errorf("invalid parameter to: %w", err)
+		}
+	}
+	query.From = query.To.Add(-defaultHistoryRange)
+	if value := values.Get("from"); value != "" {
+		if query.From, err = parseTime(value); err != nil {
+			return query, fmt.Errorf("invalid parameter from: %w", err)
+		}
+	}
+	if value := values.Get("every"); value != "" {
+		if query.Every, err = time.ParseDuration(value); err != nil {
+			return query, fmt.Errorf("invalid parameter every: %w", err)
+		}
+	}
+
+	switch {
+	case measurement == "" || strings.ContainsAny(measurement, "\"'`\\"):
+		return query, fmt.Errorf("invalid measurement %q", measurement)
+	case !query.From.Before(query.To):
+		return query, fmt.Errorf("from must be before to")
+	case query.Every < time.Second:
+		return query, fmt.Errorf("every must be at least 1s")
+	case query.To.Sub(query.From)/query.Every > maxHistoryPoints:
+		return query, fmt.Errorf("too many buckets, increase every")
+	}
+	return query, nil
+}
+
+// parseTime accepts RFC 3339 timestamps and dates in local time.
+func parseTime(value string) (time.Time, error) {
+	return parseTimeIn(value, time.Local)
+}
+
+// parseTimeIn accepts RFC 3339 timestamps and dates in the given location.
+func parseTimeIn(value string, loc *time.Location) (time.Time, error) {
+	if t, err := time.ParseInLocation(time.DateOnly, value, loc); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return t, err
+	}
+	return t.In(loc), nil
+}
@@ -0,0 +1,42 @@
+package apiserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"solarizer/loadcontrol"
+
+	"github.com/charmbracelet/log"
+)
+
+type loads struct {
+	DryRun    bool                    `json:"dry_run"`
+	Loads     []loadcontrol.LoadState `json:"loads"`
+	Decisions []loadcontrol.Decision  `json:"decisions"`
+}
+
+// getLoads returns the state of the switched loads and the switching
+// decisions, newest first.
+func (s *ApiServer) getLoads(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err, status := s.validateApiToken(r); err != nil {
+		log.Warn("Error validating API token", "err", err)
+		http.Error(w, "", status)
+		return
+	}
+	log.Debug("Received getLoads request")
+	data := loads{
+		DryRun:    s.loads.DryRun(),
+		Loads:     s.loads.States(),
+		Decisions: s.loads.Decisions(),
+	}
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(data)
+	if err != nil {
+		log.Error("Error encoding to JSON", "err", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
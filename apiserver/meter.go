@@ -0,0 +1,141 @@
+package apiserver
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/netip"
+	"os"
+	"solarizer/solarweb"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/log"
+)
+
+// meterCacheTTL is the time a power sample is reused for meter requests, evcc
+// polls every meter separately.
+const meterCacheTTL = 10 * time.Second
+
+// meterCache holds the last power sample fetched for the meters.
+type meterCache struct {
+	mu      sync.Mutex
+	data    solarweb.CompareData
+	fetched time.Time
+}
+
+// meters return a single value of a power sample in the sign conventions of
+// evcc: grid power is positive when importing, battery power is positive when
+// discharging.
+var meters = map[string]func(flow solarweb.PowerFlow) float64{
+	"grid":    solarweb.PowerFlow.GridPower,
+	"pv":      func(flow solarweb.PowerFlow) float64 { return flow.Production },
+	"battery": solarweb.PowerFlow.BatteryPower,
+	"soc":     func(flow solarweb.PowerFlow) float64 { return flow.BatterySOC },
+}
+
+// initMeterNetworks parses the networks allowed to query the meters without
+// API token.
+func (s *ApiServer) initMeterNetworks() {
+	env := os.Getenv("METER_TRUSTED_NETWORKS")
+	if env == "" {
+		return
+	}
+	for _, value := range strings.Split(env, ",") {
+		prefix, err := netip.ParsePrefix(strings.TrimSpace(value))
+		if err != nil {
+			log.Fatal("Invalid environment variable", "name", "METER_TRUSTED_NETWORKS", "err", err)
+		}
+		s.meterNetworks = append(s.meterNetworks, prefix.Masked())
+	}
+}
+
+// isTrustedMeterClient reports whether the request comes from a trusted
+// network. Forwarding headers are ignored, so behind a reverse proxy the
+// address of the proxy is checked.
+func (s *ApiServer) isTrustedMeterClient(r *http.Request) bool {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return false
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range s.meterNetworks {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// getMeter returns the current value of a meter as plain number, or as JSON
+// object {"value": ...} with format=json, for custom meters of evcc. While the
+// system is offline or its data is frozen, it responds with 503 so evcc does
+// not act on outdated values.
+func (s *ApiServer) getMeter(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.isTrustedMeterClient(r) {
+		if err, status := s.validateApiToken(r); err != nil {
+			log.Warn("Error validating API token", "err", err)
+			http.Error(w, "", status)
+			return
+		}
+	}
+	meter, ok := meters[r.PathValue("meter")]
+	if !ok {
+		http.Error(w, "unknown meter, expected grid, pv, battery or soc", http.StatusNotFound)
+		return
+	}
+	log.Debug("Received getMeter request", "meter", r.PathValue("meter"))
+	data, err := s.meterSample(r.Context())
+	if err != nil {
+		log.Error("Error requesting power data", "err", err)
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	if !data.IsOnline {
+		http.Error(w, "PV system is offline", http.StatusServiceUnavailable)
+		return
+	}
+	if s.availability != nil && s.availability.Status(time.Now()).Frozen {
+		http.Error(w, "PV system data is frozen", http.StatusServiceUnavailable)
+		return
+	}
+
+	value := meter(data.Flow())
+	switch r.URL.Query().Get("format") {
+	case "json":
+		w.Header().Set("Content-Type", "application/json")
+		err = json.NewEncoder(w).Encode(map[string]float64{"value": value})
+		if err != nil {
+			log.Error("Error encoding to JSON", "err", err)
+		}
+	default:
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = w.Write([]byte(strconv.FormatFloat(value, 'f', -1, 64) + "\n"))
+	}
+}
+
+// meterSample returns the cached power sample or fetches a new one.
+func (s *ApiServer) meterSample(ctx context.Context) (solarweb.CompareData, error) {
+	s.meterCache.mu.Lock()
+	defer s.meterCache.mu.Unlock()
+	if time.Since(s.meterCache.fetched) < meterCacheTTL {
+		return s.meterCache.data, nil
+	}
+	data, err := s.solarWebClient.GetCompareData(ctx)
+	if err != nil {
+		return data, err
+	}
+	s.meterCache.data, s.meterCache.fetched = data, time.Now()
+	return data, nil
+}
@@ -0,0 +1,81 @@
+package apiserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"solarizer/solarweb"
+	"testing"
+	"time"
+)
+
+// newMeterServer creates a server trusting 192.168.1.0/24 with a cached sample.
+func newMeterServer(t *testing.T, data solarweb.CompareData) *ApiServer {
+	t.Helper()
+	t.Setenv("METER_TRUSTED_NETWORKS", "192.168.1.0/24, fd00::/8")
+	s := newTestServer(t, Backends{})
+	s.meterCache.data, s.meterCache.fetched = data, time.Now()
+	return s
+}
+
+func getMeterResponse(s *ApiServer, path string, remoteAddr string, token string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodGet, path, nil)
+	r.RemoteAddr = remoteAddr
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	s.server.Handler.ServeHTTP(w, r)
+	return w
+}
+
+func TestMeterAccess(t *testing.T) {
+	s := newMeterServer(t, solarweb.CompareData{IsOnline: true, PowerGrid: 300})
+	for _, tt := range []struct {
+		name       string
+		remoteAddr string
+		token      string
+		want       int
+	}{
+		{"trusted network", "192.168.1.20:51234", "", http.StatusOK},
+		{"trusted IPv6 network", "[fd00::20]:51234", "", http.StatusOK},
+		{"IPv4-mapped IPv6 address in trusted network", "[::ffff:192.168.1.20]:51234", "", http.StatusOK},
+		{"untrusted address without token", "192.168.2.20:51234", "", http.StatusUnauthorized},
+		{"untrusted address with invalid token", "192.168.2.20:51234", "wrong", http.StatusForbidden},
+		{"untrusted address with token", "192.168.2.20:51234", "token", http.StatusOK},
+		{"IPv4-mapped IPv6 address outside trusted network", "[::ffff:10.0.0.1]:51234", "", http.StatusUnauthorized},
+		{"invalid remote address", "unknown", "", http.StatusUnauthorized},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := getMeterResponse(s, "/api/pv/meter/grid", tt.remoteAddr, tt.token); w.Code != tt.want {
+				t.Fatalf("GET /api/pv/meter/grid from %s = %d, want %d", tt.remoteAddr, w.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestMeterValues(t *testing.T) {
+	s := newMeterServer(t, solarweb.CompareData{IsOnline: true, PowerPV: 4200, PowerGrid: -1500, PowerLoad: -700,
+		PowerBattery: -2000, BatteryPercentage: 55.5})
+	for path, want := range map[string]string{
+		"/api/pv/meter/grid":                "-1500\n",
+		"/api/pv/meter/pv":                  "4200\n",
+		"/api/pv/meter/battery":             "-2000\n",
+		"/api/pv/meter/soc":                 "55.5\n",
+		"/api/pv/meter/battery?format=json": "{\"value\":-2000}\n",
+	} {
+		w := getMeterResponse(s, path, "192.168.1.20:51234", "")
+		if w.Code != http.StatusOK || w.Body.String() != want {
+			t.Errorf("GET %s = %d %q, want %q", path, w.Code, w.Body.String(), want)
+		}
+	}
+	if w := getMeterResponse(s, "/api/pv/meter/load", "192.168.1.20:51234", ""); w.Code != http.StatusNotFound {
+		t.Errorf("GET /api/pv/meter/load = %d, want 404", w.Code)
+	}
+}
+
+func TestMeterOffline(t *testing.T) {
+	s := newMeterServer(t, solarweb.CompareData{PowerGrid: 300})
+	if w := getMeterResponse(s, "/api/pv/meter/grid", "192.168.1.20:51234", ""); w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("GET /api/pv/meter/grid of offline system = %d, want 503", w.Code)
+	}
+}
@@ -0,0 +1,63 @@
+package apiserver
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"solarizer/influx"
+	"sort"
+
+	"github.com/charmbracelet/log"
+)
+
+// getMetrics renders the importer and SolarWeb counters in the Prometheus text
+// exposition format.
+func (s *ApiServer) getMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err, status := s.validateApiToken(r); err != nil {
+		log.Warn("Error validating API token", "err", err)
+		http.Error(w, "", status)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	solarWebStatus := s.solarWebClient.Status()
+	writeMetric(w, "solarizer_solarweb_up", "gauge", "Whether the last SolarWeb request succeeded.", boolToFloat(solarWebStatus.Healthy()))
+	writeMetric(w, "solarizer_solarweb_circuit_open", "gauge", "Whether the SolarWeb circuit breaker is open.", boolToFloat(solarWebStatus.CircuitState == "open"))
+	if s.importer != nil {
+		stats := s.importer.Stats()
+		writeSinkMetric(w, "solarizer_sink_points_total", "Points queued for writing.", stats, func(s influx.Stats) uint64 { return s.Points })
+		writeSinkMetric(w, "solarizer_sink_write_errors_total", "Failed writes.", stats, func(s influx.Stats) uint64 { return s.WriteErrors })
+		writeSinkMetric(w, "solarizer_sink_write_retries_total", "Failed batches scheduled for retry.", stats, func(s influx.Stats) uint64 { return s.Retries })
+		writeSinkMetric(w, "solarizer_sink_write_discarded_total", "Failed batches or points discarded without retry.", stats, func(s influx.Stats) uint64 { return s.Discarded })
+		writeSinkMetric(w, "solarizer_sink_spooled_total", "Failed batches spooled to disk.", stats, func(s influx.Stats) uint64 { return s.Spooled })
+		writeSinkMetric(w, "solarizer_sink_replayed_total", "Spooled batches written.", stats, func(s influx.Stats) uint64 { return s.Replayed })
+	}
+}
+
+func writeMetric(w io.Writer, name string, metricType string, help string, value float64) {
+	_, _ = fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n%s %g\n", name, help, name, metricType, name, value)
+}
+
+// writeSinkMetric writes one counter with a sample per sink.
+func writeSinkMetric(w io.Writer, name string, help string, stats map[string]influx.Stats, value func(influx.Stats) uint64) {
+	_, _ = fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", name, help, name)
+	sinks := make([]string, 0, len(stats))
+	for sink := range stats {
+		sinks = append(sinks, sink)
+	}
+	sort.Strings(sinks)
+	for _, sink := range sinks {
+		_, _ = fmt.Fprintf(w, "%s{sink=%q} %d\n", name, sink, value(stats[sink]))
+	}
+}
+
+func boolToFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
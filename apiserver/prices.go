@@ -0,0 +1,122 @@
+package apiserver
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"solarizer/tariff"
+	"strconv"
+	"time"
+
+	"github.com/charmbracelet/log"
+)
+
+const defaultPriceWindow = 24 * time.Hour
+
+type pricesResponse struct {
+	Currency  string         `json:"currency"`
+	LastFetch time.Time      `json:"last_fetch"`
+	Error     string         `json:"error,omitempty"`
+	Prices    []tariff.Price `json:"prices"`
+}
+
+type cheapestResponse struct {
+	Currency  string         `json:"currency"`
+	MeanPrice float64        `json:"mean_price"`
+	Prices    []tariff.Price `json:"prices"`
+}
+
+// getPrices returns the dynamic prices of the current and the upcoming slots.
+// The optional query parameter within limits the prices to the given
+// duration, 24h by default.
+func (s *ApiServer) getPrices(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err, status := s.validateApiToken(r); err != nil {
+		log.Warn("Error validating API token", "err", err)
+		http.Error(w, "", status)
+		return
+	}
+	log.Debug("Received getPrices request")
+	within, err := parseWithin(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	data := pricesResponse{
+		Currency: s.costs.Snapshot().Currency,
+		Prices:   s.prices.Upcoming(time.Now(), within),
+	}
+	var fetchErr error
+	data.LastFetch, fetchErr = s.prices.Status()
+	if fetchErr != nil {
+		data.Error = fetchErr.Error()
+	}
+	writeJSON(w, data)
+}
+
+// getCheapestPrices returns the cheapest upcoming slots. The query parameter
+// hours is converted to the number of slots covering it, within limits the
+// search to the given duration, 24h by default. The current slot is excluded,
+// as it has already started. If contiguous is "true", the cheapest adjacent
+// slots are returned, e.g. to run a dishwasher.
+func (s *ApiServer) getCheapestPrices(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err, status := s.validateApiToken(r); err != nil {
+		log.Warn("Error validating API token", "err", err)
+		http.Error(w, "", status)
+		return
+	}
+	log.Debug("Received getCheapestPrices request")
+	values := r.URL.Query()
+	within, err := parseWithin(values)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	hours := 1
+	if value := values.Get("hours"); value != "" {
+		if hours, err = strconv.Atoi(value); err != nil || hours < 1 {
+			http.Error(w, "invalid parameter hours", http.StatusBadRequest)
+			return
+		}
+	}
+
+	now := time.Now()
+	upcoming := slices.DeleteFunc(s.prices.Upcoming(now, within), func(price tariff.Price) bool {
+		return price.Start.Before(now)
+	})
+	slots := tariff.SlotsFor(upcoming, time.Duration(hours)*time.Hour)
+	cheapest := tariff.Cheapest(upcoming, slots, values.Get("contiguous") == "true")
+	if cheapest == nil {
+		http.Error(w, "Not enough upcoming prices", http.StatusNotFound)
+		return
+	}
+	data := cheapestResponse{
+		Currency: s.costs.Snapshot().Currency,
+		Prices:   cheapest,
+	}
+	for _, price := range cheapest {
+		data.MeanPrice += price.Import / float64(len(cheapest))
+	}
+	writeJSON(w, data)
+}
+
+func parseWithin(values url.Values) (time.Duration, error) {
+	value := values.Get("within")
+	if value == "" {
+		return defaultPriceWindow, nil
+	}
+	within, err := time.ParseDuration(value)
+	if err != nil || within <= 0 {
+		return 0, fmt.Errorf("invalid parameter within")
+	}
+	return within, nil
+}
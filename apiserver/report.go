@@ -0,0 +1,56 @@
+package apiserver
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"solarizer/report"
+
+	"github.com/charmbracelet/log"
+)
+
+// getReport returns the report of a day or a month as JSON, Markdown or HTML.
+func (s *ApiServer) getReport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err, status := s.validateApiToken(r); err != nil {
+		log.Warn("Error validating API token", "err", err)
+		http.Error(w, "", status)
+		return
+	}
+	log.Debug("Received getReport request")
+	summary, err := s.reports.Load(r.PathValue("period"))
+	switch {
+	case errors.Is(err, report.ErrInvalidPeriod):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case errors.Is(err, report.ErrNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case err != nil:
+		log.Error("Error loading report", "err", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	switch format := r.URL.Query().Get("format"); format {
+	case "md":
+		w.Header().Set("Content-Type", "text/markdown; charset=utf-8")
+		_, _ = w.Write([]byte(summary.Markdown()))
+	case "html":
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_, _ = w.Write([]byte(summary.HTML()))
+	case "", "json":
+		w.Header().Set("Content-Type", "application/json")
+		err = json.NewEncoder(w).Encode(summary)
+		if err != nil {
+			log.Error("Error encoding to JSON", "err", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	default:
+		http.Error(w, "invalid format, expected json, md or html", http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,42 @@
+package apiserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"solarizer/availability"
+	"solarizer/solarweb"
+	"time"
+
+	"github.com/charmbracelet/log"
+)
+
+type status struct {
+	availability.Status
+	SolarWeb solarweb.Status `json:"solarweb"`
+}
+
+// getStatus returns the connectivity of SolarWeb and the PV system, the time
+// of the last change of the data and the outage history.
+func (s *ApiServer) getStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err, status := s.validateApiToken(r); err != nil {
+		log.Warn("Error validating API token", "err", err)
+		http.Error(w, "", status)
+		return
+	}
+	log.Debug("Received getStatus request")
+	data := status{
+		Status:   s.availability.Status(time.Now()),
+		SolarWeb: s.solarWebClient.Status(),
+	}
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(data)
+	if err != nil {
+		log.Error("Error encoding to JSON", "err", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
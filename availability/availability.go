@@ -0,0 +1,212 @@
+package availability
+
+import (
+	"solarizer/solarweb"
+	"solarizer/statefile"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/log"
+	influxdb2 "github.com/influxdata/influxdb-client-go/v2"
+	"github.com/influxdata/influxdb-client-go/v2/api/write"
+)
+
+// maxOutages is the number of outages kept in the history.
+const maxOutages = 100
+
+// Reasons of an outage.
+const (
+	ReasonOffline        = "offline"         // the inverter is reported offline
+	ReasonDevicesOffline = "devices_offline" // the inverter is online, but not all devices
+	ReasonFrozen         = "frozen"          // SolarWeb returns identical values
+)
+
+// Outage is a period the PV system was offline or its data was frozen. End is
+// zero while the outage is ongoing.
+type Outage struct {
+	Reason string    `json:"reason"`
+	Start  time.Time `json:"start"`
+	End    time.Time `json:"end"`
+}
+
+// Duration returns the duration of the outage, of an ongoing one until now.
+func (o Outage) Duration(now time.Time) time.Duration {
+	if o.End.IsZero() {
+		return now.Sub(o.Start)
+	}
+	return o.End.Sub(o.Start)
+}
+
+// Status summarizes the availability of the PV system and its data.
+type Status struct {
+	Time         time.Time `json:"time"` // time of the last sample
+	Online       bool      `json:"online"`
+	AllOnline    bool      `json:"all_online"`
+	OfflineSince time.Time `json:"offline_since"`
+	LastChange   time.Time `json:"last_change"` // last sample with different values
+	Frozen       bool      `json:"frozen"`
+	Stale        bool      `json:"stale"` // no sample within the stale duration
+	Outages      []Outage  `json:"outages"`
+}
+
+// state is persisted whenever an outage starts or ends.
+type state struct {
+	Outages []Outage `json:"outages"` // oldest first, the last one may be ongoing
+}
+
+// Tracker detects offline systems and frozen data from the power samples and
+// keeps a history of outages. It implements influx.PowerObserver.
+type Tracker struct {
+	staleAfter time.Duration
+	filename   string // optional, outages are not persisted if empty
+
+	mu           sync.Mutex
+	last         time.Time
+	values       solarweb.CompareData
+	lastChange   time.Time
+	offlineSince time.Time
+	state        state
+}
+
+// NewTracker creates a tracker that flags data as frozen or stale after
+// staleAfter without changes or samples. The outages are persisted in
+// filename, outages found there are continued.
+func NewTracker(staleAfter time.Duration, filename string) (*Tracker, error) {
+	t := &Tracker{staleAfter: staleAfter, filename: filename}
+	if filename == "" {
+		return t, nil
+	}
+	restored, err := statefile.Load(filename, &t.state)
+	if err != nil {
+		return nil, err
+	}
+	if restored {
+		log.Info("Restored outages", "count", len(t.state.Outages))
+	}
+	return t, nil
+}
+
+// ObservePower updates the status with the sample and returns the measurement
+// "availability".
+func (t *Tracker) ObservePower(now time.Time, data solarweb.CompareData) []*write.Point {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !now.After(t.last) {
+		return nil
+	}
+	if t.last.IsZero() || !sameValues(t.values, data) {
+		t.lastChange = now
+	}
+	t.last, t.values = now, data
+	switch {
+	case data.IsOnline:
+		t.offlineSince = time.Time{}
+	case t.offlineSince.IsZero():
+		t.offlineSince = now
+	}
+	t.update(now, t.reason(now))
+
+	offline := 0.0
+	if !t.offlineSince.IsZero() {
+		offline = now.Sub(t.offlineSince).Seconds()
+	}
+	return []*write.Point{
+		influxdb2.NewPointWithMeasurement("availability").
+			AddField("offline_seconds", offline).
+			AddField("unchanged_seconds", now.Sub(t.lastChange).Seconds()).
+			AddField("frozen", t.frozen(now)).
+			SetTime(now),
+	}
+}
+
+// Status returns the status at now. The outages are sorted newest first.
+func (t *Tracker) Status(now time.Time) Status {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	outages := make([]Outage, len(t.state.Outages))
+	for i, outage := range t.state.Outages {
+		outages[len(outages)-1-i] = outage
+	}
+	return Status{
+		Time:         t.last,
+		Online:       t.values.IsOnline,
+		AllOnline:    t.values.AllOnline,
+		OfflineSince: t.offlineSince,
+		LastChange:   t.lastChange,
+		Frozen:       t.frozen(now),
+		Stale:        t.stale(now),
+		Outages:      outages,
+	}
+}
+
+// reason returns the reason of the current outage or "" if there is none.
+func (t *Tracker) reason(now time.Time) string {
+	switch {
+	case !t.values.IsOnline:
+		return ReasonOffline
+	case !t.values.AllOnline:
+		return ReasonDevicesOffline
+	case t.frozen(now):
+		return ReasonFrozen
+	default:
+		return ""
+	}
+}
+
+// frozen reports whether samples keep arriving with identical values. Without
+// recent samples the data is stale instead.
+func (t *Tracker) frozen(now time.Time) bool {
+	return !t.lastChange.IsZero() && t.last.Sub(t.lastChange) >= t.staleAfter && !t.stale(now)
+}
+
+// stale reports whether no sample arrived within the stale duration.
+func (t *Tracker) stale(now time.Time) bool {
+	return !t.last.IsZero() && now.Sub(t.last) > t.staleAfter
+}
+
+// update ends the ongoing outage and starts a new one if the reason changed.
+// A frozen outage starts with the last change of the values.
+func (t *Tracker) update(now time.Time, reason string) {
+	outages := t.state.Outages
+	var current *Outage
+	if n := len(outages); n > 0 && outages[n-1].End.IsZero() {
+		current = &outages[n-1]
+	}
+	if current != nil && current.Reason == reason {
+		return
+	}
+	if current == nil && reason == "" {
+		return
+	}
+
+	if current != nil {
+		current.End = now
+		log.Info("Outage ended", "reason", current.Reason, "duration", current.Duration(now))
+	}
+	if reason != "" {
+		start := now
+		if reason == ReasonFrozen {
+			start = t.lastChange
+		}
+		outages = append(outages, Outage{Reason: reason, Start: start})
+		log.Warn("Outage started", "reason", reason, "since", start)
+	}
+	if len(outages) > maxOutages {
+		outages = outages[len(outages)-maxOutages:]
+	}
+	t.state.Outages = outages
+	if t.filename != "" {
+		if err := statefile.Save(t.filename, &t.state); err != nil {
+			log.Error("Unable to persist outages", "err", err)
+		}
+	}
+}
+
+// sameValues reports whether SolarWeb returned identical values.
+func sameValues(a solarweb.CompareData, b solarweb.CompareData) bool {
+	return a.PowerGrid == b.PowerGrid &&
+		a.PowerLoad == b.PowerLoad &&
+		a.PowerPV == b.PowerPV &&
+		a.PowerBattery == b.PowerBattery &&
+		a.BatteryPercentage == b.BatteryPercentage
+}
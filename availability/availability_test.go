@@ -0,0 +1,61 @@
+package availability
+
+import (
+	"path/filepath"
+	"solarizer/solarweb"
+	"testing"
+	"time"
+)
+
+func TestOutages(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "availability.json")
+	tracker, err := NewTracker(10*time.Minute, filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	online := solarweb.CompareData{IsOnline: true, AllOnline: true, PowerPV: 3000, PowerLoad: -500}
+	sample := func(minute int, data solarweb.CompareData) {
+		tracker.ObservePower(start.Add(time.Duration(minute)*time.Minute), data)
+	}
+	// Offline from 12:05 to 12:10, then frozen values from 12:10 until 12:30
+	sample(0, online)
+	sample(5, solarweb.CompareData{})
+	sample(6, solarweb.CompareData{})
+	for minute := 10; minute <= 25; minute += 5 {
+		sample(minute, online)
+	}
+	online.PowerPV = 2500
+	sample(30, online)
+
+	status := tracker.Status(start.Add(30 * time.Minute))
+	if !status.Online || status.Frozen || status.Stale || !status.LastChange.Equal(start.Add(30*time.Minute)) {
+		t.Fatalf("status = %+v, want online with fresh data", status)
+	}
+	want := []Outage{
+		{Reason: ReasonFrozen, Start: start.Add(10 * time.Minute), End: start.Add(30 * time.Minute)},
+		{Reason: ReasonOffline, Start: start.Add(5 * time.Minute), End: start.Add(10 * time.Minute)},
+	}
+	if len(status.Outages) != len(want) {
+		t.Fatalf("outages = %+v, want %+v", status.Outages, want)
+	}
+	for i := range want {
+		got := status.Outages[i]
+		if got.Reason != want[i].Reason || !got.Start.Equal(want[i].Start) || !got.End.Equal(want[i].End) {
+			t.Fatalf("outage %d = %+v, want %+v", i, got, want[i])
+		}
+	}
+	if stale := tracker.Status(start.Add(45 * time.Minute)); !stale.Stale || stale.Frozen {
+		t.Fatalf("status = %+v, want stale and not frozen without samples", stale)
+	}
+
+	// Outages survive a restart
+	restored, err := NewTracker(10*time.Minute, filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if outages := restored.Status(start).Outages; len(outages) != 2 {
+		t.Fatalf("restored outages = %+v, want 2", outages)
+	}
+}
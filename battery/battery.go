@@ -0,0 +1,246 @@
+package battery
+
+import (
+	"solarizer/energy"
+	"solarizer/solarweb"
+	"solarizer/statefile"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/log"
+	influxdb2 "github.com/influxdata/influxdb-client-go/v2"
+	"github.com/influxdata/influxdb-client-go/v2/api/write"
+)
+
+const (
+	// maxMonths is the number of months kept for the trend
+	maxMonths = 36
+	// minSpan is the state of charge in percentage points a discharge must
+	// span to estimate the usable capacity, short discharges are dominated by
+	// the rounding of the state of charge
+	minSpan = 20
+	// reversal is the rise of the state of charge in percentage points that
+	// ends a discharge
+	reversal = 2
+)
+
+// Month holds the battery statistics of a month, energy in Wh.
+type Month struct {
+	Month     string  `json:"month"` // "2006-01"
+	Charge    float64 `json:"charge"`
+	Discharge float64 `json:"discharge"`
+	StartSOC  float64 `json:"start_soc"` // state of charge at the first sample of the month
+	EndSOC    float64 `json:"end_soc"`   // state of charge at the last sample of the month
+	// CapacitySum is the sum of the usable capacity estimates of the discharges
+	// of the month
+	CapacitySum float64 `json:"capacity_sum"`
+	Discharges  int     `json:"discharges"`
+}
+
+// MonthStats are the statistics of a month derived with the capacity.
+type MonthStats struct {
+	Month      string  `json:"month"`
+	Charge     float64 `json:"charge"`
+	Discharge  float64 `json:"discharge"`
+	Cycles     float64 `json:"cycles"`     // equivalent full cycles
+	Efficiency float64 `json:"efficiency"` // round-trip efficiency estimate, 0 if unknown
+	Capacity   float64 `json:"capacity"`   // mean usable capacity estimate in Wh, 0 if unknown
+	Discharges int     `json:"discharges"` // discharges the capacity was estimated from
+}
+
+// Stats are the battery statistics since the first sample.
+type Stats struct {
+	Time              time.Time    `json:"time"`
+	SOC               float64      `json:"soc"`
+	NominalCapacity   float64      `json:"nominal_capacity"`   // configured capacity in Wh, 0 if unknown
+	EstimatedCapacity float64      `json:"estimated_capacity"` // latest monthly capacity estimate in Wh
+	Health            float64      `json:"health"`             // estimated to nominal capacity, 0 if unknown
+	Charge            float64      `json:"charge"`
+	Discharge         float64      `json:"discharge"`
+	Cycles            float64      `json:"cycles"`
+	Months            []MonthStats `json:"months"` // oldest first
+}
+
+// segment is the ongoing discharge since the last local maximum of the
+// state of charge.
+type segment struct {
+	StartSOC    float64 `json:"start_soc"`
+	LowSOC      float64 `json:"low_soc"`
+	Energy      float64 `json:"energy"`        // net energy out of the battery since the start
+	EnergyAtLow float64 `json:"energy_at_low"` // net energy out of the battery until LowSOC
+}
+
+// batteryState is persisted after every sample.
+type batteryState struct {
+	Last      time.Time `json:"last"`
+	SOC       float64   `json:"soc"`
+	Charge    float64   `json:"charge"` // energy counters at Last
+	Discharge float64   `json:"discharge"`
+	Current   segment   `json:"discharge_segment"`
+	Months    []Month   `json:"months"` // oldest first
+}
+
+// Tracker interprets the battery power and state of charge of the samples. It
+// implements influx.PowerObserver.
+type Tracker struct {
+	capacity   float64 // nominal capacity in Wh, optional
+	integrator *energy.Integrator
+	filename   string // optional, state is not persisted if empty
+
+	mu    sync.Mutex
+	state batteryState
+}
+
+// NewTracker creates a tracker that persists its state in filename and
+// continues with the statistics found there. capacity is the nominal capacity
+// in Wh or 0 if unknown, then cycles are counted with the estimated capacity.
+func NewTracker(capacity float64, integrator *energy.Integrator, filename string) (*Tracker, error) {
+	t := &Tracker{capacity: capacity, integrator: integrator, filename: filename}
+	if filename == "" {
+		return t, nil
+	}
+	restored, err := statefile.Load(filename, &t.state)
+	if err != nil {
+		return nil, err
+	}
+	if restored {
+		log.Info("Restored battery statistics", "last", t.state.Last, "months", len(t.state.Months))
+	}
+	return t, nil
+}
+
+// ObservePower adds the battery energy since the last sample and returns the
+// measurement "battery".
+func (t *Tracker) ObservePower(now time.Time, data solarweb.CompareData) []*write.Point {
+	counters, ok := t.integrator.CountersAt(now)
+	if !ok {
+		return nil
+	}
+
+	t.mu.Lock()
+	st := &t.state
+	soc := data.BatteryPercentage
+	charge := counters.Total.BatteryCharge - st.Charge
+	discharge := counters.Total.BatteryDischarge - st.Discharge
+	contiguous := !st.Last.IsZero() && now.Sub(st.Last) <= energy.MaxGap && charge >= 0 && discharge >= 0
+
+	month := now.Format("2006-01")
+	if n := len(st.Months); n == 0 || st.Months[n-1].Month != month {
+		st.Months = append(st.Months, Month{Month: month, StartSOC: soc})
+		if len(st.Months) > maxMonths {
+			st.Months = st.Months[len(st.Months)-maxMonths:]
+		}
+	}
+	current := &st.Months[len(st.Months)-1]
+	if contiguous {
+		// Like the energy counters, the interval crossing the start of a month is
+		// counted for the new one
+		current.Charge += charge
+		current.Discharge += discharge
+		t.trackDischarge(current, soc, discharge-charge)
+	} else {
+		st.Current = segment{StartSOC: soc, LowSOC: soc}
+	}
+	current.EndSOC = soc
+	st.Last, st.SOC = now, soc
+	st.Charge, st.Discharge = counters.Total.BatteryCharge, counters.Total.BatteryDischarge
+
+	if t.filename != "" {
+		if err := statefile.Save(t.filename, st); err != nil {
+			log.Error("Unable to persist battery statistics", "err", err)
+		}
+	}
+	t.mu.Unlock()
+
+	stats := t.Stats()
+	point := influxdb2.NewPointWithMeasurement("battery").
+		AddField("soc", stats.SOC).
+		AddField("charge", stats.Charge).
+		AddField("discharge", stats.Discharge).
+		AddField("cycles", stats.Cycles).
+		SetTime(now)
+	if stats.EstimatedCapacity > 0 {
+		point.AddField("estimated_capacity", stats.EstimatedCapacity)
+	}
+	if m := stats.Months[len(stats.Months)-1]; m.Efficiency > 0 {
+		point.AddField("efficiency", m.Efficiency)
+	}
+	return []*write.Point{point}
+}
+
+// trackDischarge follows the state of charge from a local maximum to the next
+// local minimum. Once the state of charge rises again, the net energy
+// discharged per percentage point estimates the usable capacity.
+func (t *Tracker) trackDischarge(month *Month, soc float64, energy float64) {
+	d := &t.state.Current
+	d.Energy += energy
+	if soc < d.LowSOC {
+		d.LowSOC, d.EnergyAtLow = soc, d.Energy
+	}
+	if soc < d.StartSOC && soc < d.LowSOC+reversal {
+		return // still discharging
+	}
+	if span := d.StartSOC - d.LowSOC; span >= minSpan && d.EnergyAtLow > 0 {
+		month.CapacitySum += d.EnergyAtLow / span * 100
+		month.Discharges++
+	}
+	*d = segment{StartSOC: soc, LowSOC: soc}
+}
+
+// Stats returns the statistics of all months.
+func (t *Tracker) Stats() Stats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	st := t.state
+	stats := Stats{
+		Time:            st.Last,
+		SOC:             st.SOC,
+		NominalCapacity: t.capacity,
+		Charge:          st.Charge,
+		Discharge:       st.Discharge,
+		Months:          make([]MonthStats, 0, len(st.Months)),
+	}
+	for _, m := range st.Months {
+		if m.Discharges > 0 {
+			stats.EstimatedCapacity = m.CapacitySum / float64(m.Discharges)
+		}
+	}
+	// Cycles are counted with the nominal capacity, the state of charge refers
+	// to the usable capacity
+	capacity, usable := t.capacity, stats.EstimatedCapacity
+	if capacity == 0 {
+		capacity = usable
+	}
+	if usable == 0 {
+		usable = capacity
+	}
+	if t.capacity > 0 && stats.EstimatedCapacity > 0 {
+		stats.Health = stats.EstimatedCapacity / t.capacity
+	}
+
+	for _, m := range st.Months {
+		ms := MonthStats{
+			Month:      m.Month,
+			Charge:     m.Charge,
+			Discharge:  m.Discharge,
+			Discharges: m.Discharges,
+		}
+		if m.Discharges > 0 {
+			ms.Capacity = m.CapacitySum / float64(m.Discharges)
+		}
+		if capacity > 0 {
+			ms.Cycles = m.Discharge / capacity
+		}
+		if usable > 0 && m.Charge > 0 {
+			// The energy stored at the end of the month was charged, but not
+			// discharged yet
+			stored := (m.EndSOC - m.StartSOC) / 100 * usable
+			ms.Efficiency = min(max((m.Discharge+stored)/m.Charge, 0), 1)
+		}
+		stats.Months = append(stats.Months, ms)
+	}
+	if capacity > 0 {
+		stats.Cycles = st.Discharge / capacity
+	}
+	return stats
+}
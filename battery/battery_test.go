@@ -0,0 +1,77 @@
+package battery
+
+import (
+	"math"
+	"path/filepath"
+	"solarizer/energy"
+	"solarizer/solarweb"
+	"testing"
+	"time"
+)
+
+func TestCapacityCyclesAndEfficiency(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "battery.json")
+	integrator, err := energy.Open("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tracker, err := NewTracker(12000, integrator, filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A lossless battery with a usable capacity of 10 kWh discharges with
+	// 1 kW from 80 % to 50 % and charges with 2 kW back to 70 %
+	start := time.Date(2025, 6, 1, 18, 0, 0, 0, time.UTC)
+	soc := 80.0
+	sample := func(minute int, power float64) {
+		if minute > 0 {
+			soc -= power / 60 / 10000 * 100
+		}
+		data := solarweb.CompareData{PowerBattery: power, BatteryPercentage: soc}
+		now := start.Add(time.Duration(minute) * time.Minute)
+		integrator.ObservePower(now, data)
+		tracker.ObservePower(now, data)
+	}
+	for minute := 0; minute <= 180; minute++ {
+		sample(minute, 1000)
+	}
+	for minute := 181; minute <= 240; minute++ {
+		sample(minute, -2000)
+	}
+
+	stats := tracker.Stats()
+	if len(stats.Months) != 1 || stats.Months[0].Discharges != 1 {
+		t.Fatalf("stats = %+v, want one month with one discharge", stats)
+	}
+	if math.Abs(stats.EstimatedCapacity-10000) > 100 {
+		t.Errorf("estimated capacity = %.0f Wh, want 10000 Wh", stats.EstimatedCapacity)
+	}
+	if math.Abs(stats.Health-10000.0/12000) > 0.01 {
+		t.Errorf("health = %.3f, want %.3f", stats.Health, 10000.0/12000)
+	}
+	if math.Abs(stats.Cycles-stats.Discharge/12000) > 1e-9 || math.Abs(stats.Discharge-3000) > 10 {
+		t.Errorf("discharge = %.0f Wh and %.3f cycles, want 3000 Wh and 0.25 cycles", stats.Discharge, stats.Cycles)
+	}
+	if month := stats.Months[0]; math.Abs(month.Efficiency-1) > 0.02 {
+		t.Errorf("efficiency = %.3f, want about 1 for a lossless battery", month.Efficiency)
+	}
+
+	// A discharge of less than 20 % does not estimate the capacity
+	for minute := 241; minute <= 300; minute++ {
+		sample(minute, 1000)
+	}
+	sample(301, -2000)
+	sample(302, -2000)
+	if discharges := tracker.Stats().Months[0].Discharges; discharges != 1 {
+		t.Errorf("discharges = %d after short discharge, want 1", discharges)
+	}
+
+	restored, err := NewTracker(12000, integrator, filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats := restored.Stats(); stats.EstimatedCapacity == 0 || stats.SOC != soc {
+		t.Errorf("restored stats = %+v", stats)
+	}
+}
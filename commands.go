@@ -0,0 +1,283 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"solarizer/export"
+	"solarizer/influx"
+	"solarizer/solarweb"
+	"strconv"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/charmbracelet/log"
+)
+
+// runLogin performs a login with the configured credentials and persists the
+// resulting auth cookie.
+func runLogin() {
+	solarWebClient := newSolarWebClient()
+	if err := solarWebClient.Login(); err != nil {
+		log.Fatal("Login failed", "err", err)
+	}
+	fmt.Println("Login successful, auth cookie stored in", authCookieFilename())
+}
+
+// runFetch fetches one kind of data from SolarWeb and prints it to stdout.
+func runFetch(args []string) {
+	if len(args) == 0 {
+		log.Fatal("Missing data kind, expected one of power, production, balance")
+	}
+	kind := args[0]
+	flags := flag.NewFlagSet("fetch", flag.ExitOnError)
+	format := flags.String("format", "json", "output format (json or table)")
+	_ = flags.Parse(args[1:])
+	if *format != "json" && *format != "table" {
+		log.Fatal("Unknown output format", "format", *format)
+	}
+
+	solarWebClient := newSolarWebClient()
+
+	var data any
+	var rows [][2]string
+	switch kind {
+	case "power":
+		d, err := solarWebClient.GetCompareData(context.Background())
+		if err != nil {
+			log.Fatal("Error requesting power data", "err", err)
+		}
+		data = solarweb.NewPowerData(d)
+		flow := d.Flow()
+		rows = [][2]string{
+			{"Online", strconv.FormatBool(d.IsOnline)},
+			{"All online", strconv.FormatBool(d.AllOnline)},
+			{"Production", formatWatts(flow.Production)},
+			{"Consumption", formatWatts(flow.Consumption)},
+			{"Grid", formatWatts(max(flow.GridImport, flow.GridExport)) + " " + flow.GridDirection},
+			{"Battery", formatWatts(max(flow.BatteryCharge, flow.BatteryDischarge)) + " " + flow.BatteryDirection},
+			{"Battery SOC", fmt.Sprintf("%g %%", flow.BatterySOC)},
+			{"Battery mode", fmt.Sprintf("%s (%g)", d.BatteryModeName, d.BatteryMode)},
+		}
+	case "production":
+		d, err := solarWebClient.GetProductionsAndEarnings(context.Background())
+		if err != nil {
+			log.Fatal("Error requesting earnings data", "err", err)
+		}
+		data = d
+		e, p := d.Data.Earnings, d.Data.Productions
+		rows = [][2]string{
+			{"Production today", p.Today + " " + p.TodayUnit},
+			{"Production month", p.Month + " " + p.MonthUnit},
+			{"Production year", p.Year + " " + p.YearUnit},
+			{"Production total", p.Total + " " + p.TotalUnit},
+			{"Earnings today", e.Today + " " + e.IsoCurrency},
+			{"Earnings month", e.Month + " " + e.IsoCurrency},
+			{"Earnings year", e.Year + " " + e.IsoCurrency},
+			{"Earnings total", e.Total + " " + e.IsoCurrency},
+		}
+	case "balance":
+		d, err := solarWebClient.GetWidgetChart(context.Background())
+		if err != nil {
+			log.Fatal("Error requesting balance data", "err", err)
+		}
+		data = d
+		rows = [][2]string{
+			{"Has meter", strconv.FormatBool(d.HasMeter)},
+			{"To grid today", d.ToGrid},
+			{"From grid today", d.FromGrid},
+		}
+	default:
+		log.Fatal("Unknown data kind, expected one of power, production, balance", "kind", kind)
+	}
+
+	if *format == "table" {
+		printTable(rows)
+		return
+	}
+	printJSON(data)
+}
+
+// runCookie shows or sets the persisted auth cookie.
+func runCookie(args []string) {
+	if len(args) == 0 {
+		log.Fatal("Missing cookie command, expected set or show")
+	}
+	// Credentials are not needed to manage the cookie file
+	solarWebClient := solarweb.New(os.Getenv("SOLAR_WEB_PV_SYSTEM_ID"), authCookieFilename(), "", "")
+
+	switch args[0] {
+	case "show":
+		cookie := solarWebClient.AuthCookie()
+		if cookie == "" {
+			log.Fatal("No auth cookie stored", "filename", authCookieFilename())
+		}
+		fmt.Println(cookie)
+	case "set":
+		if len(args) < 2 || args[1] == "" {
+			log.Fatal("Missing cookie value")
+		}
+		solarWebClient.SetAuthCookie(args[1])
+	default:
+		log.Fatal("Unknown cookie command, expected set or show", "command", args[0])
+	}
+}
+
+// runBackfill imports the daily production charts of a date range into Influx.
+func runBackfill(args []string) {
+	flags := flag.NewFlagSet("backfill", flag.ExitOnError)
+	fromFlag := flags.String("from", "", "first day to import (YYYY-MM-DD)")
+	toFlag := flags.String("to", "", "last day to import (YYYY-MM-DD), defaults to today")
+	_ = flags.Parse(args)
+
+	from, err := time.ParseInLocation(time.DateOnly, *fromFlag, time.Local)
+	if err != nil {
+		log.Fatal("Invalid --from date", "err", err)
+	}
+	to := time.Now()
+	if *toFlag != "" {
+		to, err = time.ParseInLocation(time.DateOnly, *toFlag, time.Local)
+		if err != nil {
+			log.Fatal("Invalid --to date", "err", err)
+		}
+	}
+	if to.Before(from) {
+		log.Fatal("--to must not be before --from")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer stop()
+
+	sinks, _ := newSinks()
+	importer := influx.NewImporter(newSolarWebClient(), sinks...)
+	err = importer.Backfill(ctx, from, to)
+	importer.Close()
+	if err != nil {
+		log.Fatal("Backfill failed", "err", err)
+	}
+	log.Info("Backfill complete")
+}
+
+// runExport writes the power, production and balance series of the history
+// database or Influx bucket as CSV or Parquet file.
+func runExport(args []string) {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	fromFlag := flags.String("from", "", "first day to export (YYYY-MM-DD)")
+	toFlag := flags.String("to", "", "last day to export (YYYY-MM-DD), defaults to today")
+	every := flags.Duration("every", time.Hour, "resolution of the exported values")
+	format := flags.String("format", "csv", "output format: csv or parquet")
+	tz := flags.String("tz", "", "IANA time zone of the timestamps, defaults to local time")
+	output := flags.String("output", "", "output file, defaults to stdout")
+	_ = flags.Parse(args)
+
+	loc := time.Local
+	if *tz != "" {
+		var err error
+		if loc, err = time.LoadLocation(*tz); err != nil {
+			log.Fatal("Invalid --tz", "err", err)
+		}
+	}
+	from, err := time.ParseInLocation(time.DateOnly, *fromFlag, loc)
+	if err != nil {
+		log.Fatal("Invalid --from date", "err", err)
+	}
+	to := time.Now().In(loc)
+	if *toFlag != "" {
+		to, err = time.ParseInLocation(time.DateOnly, *toFlag, loc)
+		if err != nil {
+			log.Fatal("Invalid --to date", "err", err)
+		}
+		// Include the last day
+		to = to.AddDate(0, 0, 1)
+	}
+	if !from.Before(to) {
+		log.Fatal("--to must not be before --from")
+	}
+	if *every < time.Second {
+		log.Fatal("--every must be at least 1s")
+	}
+	write := export.WriteCSV
+	switch *format {
+	case "csv":
+	case "parquet":
+		write = export.WriteParquet
+	default:
+		log.Fatal("Invalid --format, must be csv or parquet", "format", *format)
+	}
+
+	source, closeSource := newHistorySource()
+	defer closeSource()
+	table, err := export.Collect(context.Background(), source, from, to, *every)
+	if err != nil {
+		log.Fatal("Unable to query history", "err", err)
+	}
+
+	out := io.Writer(os.Stdout)
+	if *output != "" {
+		file, err := os.Create(*output)
+		if err != nil {
+			log.Fatal("Unable to create output file", "err", err)
+		}
+		defer file.Close()
+		out = file
+	}
+	if err := write(out, table); err != nil {
+		log.Fatal("Unable to write export", "err", err)
+	}
+}
+
+// runHealthcheck queries the health endpoints of a running server and exits
+// with a non-zero status if one of them does not succeed. It is meant to be
+// used as Docker HEALTHCHECK in images without a shell.
+func runHealthcheck(args []string) {
+	flags := flag.NewFlagSet("healthcheck", flag.ExitOnError)
+	addr := flags.String("addr", "http://127.0.0.1"+apiServerAddr, "base URL of the API server")
+	live := flags.Bool("live", false, "only check liveness, skip readiness")
+	_ = flags.Parse(args)
+
+	endpoints := []string{"/healthz"}
+	if !*live {
+		endpoints = append(endpoints, "/readyz")
+	}
+	client := &http.Client{Timeout: 5 * time.Second}
+	for _, endpoint := range endpoints {
+		resp, err := client.Get(*addr + endpoint)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, endpoint, err)
+			os.Exit(1)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			fmt.Fprintln(os.Stderr, endpoint, resp.Status, strings.TrimSpace(string(body)))
+			os.Exit(1)
+		}
+	}
+}
+
+func printJSON(data any) {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(data); err != nil {
+		log.Fatal("Error encoding to JSON", "err", err)
+	}
+}
+
+func printTable(rows [][2]string) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, row := range rows {
+		_, _ = fmt.Fprintf(w, "%s\t%s\n", row[0], row[1])
+	}
+	_ = w.Flush()
+}
+
+func formatWatts(value float64) string {
+	return strconv.FormatFloat(value, 'f', 0, 64) + " W"
+}
@@ -0,0 +1,198 @@
+package energy
+
+import (
+	"solarizer/solarweb"
+	"solarizer/statefile"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/log"
+	influxdb2 "github.com/influxdata/influxdb-client-go/v2"
+	"github.com/influxdata/influxdb-client-go/v2/api/write"
+)
+
+// MaxGap is the longest interval between two samples that is integrated.
+// Longer gaps, e.g. while SolarWeb is unreachable or solarizer is stopped,
+// are skipped instead of being interpolated.
+const MaxGap = 5 * time.Minute
+
+// Flows are the non-negative power flows of a sample in W, or their energy
+// over a period in Wh.
+type Flows struct {
+	PV                  float64 `json:"pv"`
+	Load                float64 `json:"load"`
+	GridImport          float64 `json:"grid_import"`
+	GridExport          float64 `json:"grid_export"`
+	BatteryCharge       float64 `json:"battery_charge"`
+	BatteryDischarge    float64 `json:"battery_discharge"`
+	SelfConsumption     float64 `json:"self_consumption"`     // PV not fed into the grid
+	DirectConsumption   float64 `json:"direct_consumption"`   // PV consumed by the load without the battery
+	BatteryContribution float64 `json:"battery_contribution"` // load supplied by the battery
+}
+
+// FromSample derives the flows from the normalized flow of a sample. The
+// battery is assumed to be charged from PV before the grid.
+func FromSample(data solarweb.CompareData) Flows {
+	flow := data.Flow()
+	f := Flows{
+		PV:               flow.Production,
+		Load:             flow.Consumption,
+		GridImport:       flow.GridImport,
+		GridExport:       flow.GridExport,
+		BatteryCharge:    flow.BatteryCharge,
+		BatteryDischarge: flow.BatteryDischarge,
+	}
+	f.SelfConsumption = max(f.PV-f.GridExport, 0)
+	f.DirectConsumption = min(max(f.SelfConsumption-f.BatteryCharge, 0), f.Load)
+	f.BatteryContribution = min(f.BatteryDischarge, f.Load)
+	return f
+}
+
+// Add returns f + o*factor.
+func (f Flows) Add(o Flows, factor float64) Flows {
+	return Flows{
+		PV:                  f.PV + o.PV*factor,
+		Load:                f.Load + o.Load*factor,
+		GridImport:          f.GridImport + o.GridImport*factor,
+		GridExport:          f.GridExport + o.GridExport*factor,
+		BatteryCharge:       f.BatteryCharge + o.BatteryCharge*factor,
+		BatteryDischarge:    f.BatteryDischarge + o.BatteryDischarge*factor,
+		SelfConsumption:     f.SelfConsumption + o.SelfConsumption*factor,
+		DirectConsumption:   f.DirectConsumption + o.DirectConsumption*factor,
+		BatteryContribution: f.BatteryContribution + o.BatteryContribution*factor,
+	}
+}
+
+// Sub returns f - o.
+func (f Flows) Sub(o Flows) Flows {
+	return f.Add(o, -1)
+}
+
+// Counters are the energy counters in Wh. Total only ever increases, Day and
+// Month hold the energy since the start of the current day and month in
+// local time. Power holds the flows of the last sample in W.
+type Counters struct {
+	Time       time.Time `json:"time"`
+	Power      Flows     `json:"power"`
+	Total      Flows     `json:"total"`
+	DayStart   time.Time `json:"day_start"`
+	Day        Flows     `json:"day"`
+	MonthStart time.Time `json:"month_start"`
+	Month      Flows     `json:"month"`
+}
+
+// state is persisted after every sample. The counters of the day and month
+// are stored as the totals at their start.
+type state struct {
+	Last       time.Time `json:"last"`
+	Prev       Flows     `json:"prev"` // flows of the last sample in W
+	Total      Flows     `json:"total"`
+	DayStart   time.Time `json:"day_start"`
+	DayBase    Flows     `json:"day_base"`
+	MonthStart time.Time `json:"month_start"`
+	MonthBase  Flows     `json:"month_base"`
+}
+
+// Integrator integrates the power samples over time into energy counters
+// using the trapezoidal rule. It implements influx.PowerObserver.
+type Integrator struct {
+	mu       sync.Mutex
+	filename string // optional, state is not persisted if empty
+	state    state
+}
+
+// Open creates an integrator that persists its counters in filename and
+// continues with the counters found there.
+func Open(filename string) (*Integrator, error) {
+	i := &Integrator{filename: filename}
+	if filename == "" {
+		return i, nil
+	}
+	restored, err := statefile.Load(filename, &i.state)
+	if err != nil {
+		return nil, err
+	}
+	if restored {
+		log.Info("Restored energy counters", "last", i.state.Last, "pv", i.state.Total.PV)
+	}
+	return i, nil
+}
+
+// ObservePower integrates the sample and returns the measurement "energy"
+// with the total counters. Samples older than the last one are ignored.
+func (i *Integrator) ObservePower(now time.Time, data solarweb.CompareData) []*write.Point {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	st := &i.state
+	if !now.After(st.Last) {
+		return nil
+	}
+
+	flows := FromSample(data)
+	if elapsed := now.Sub(st.Last); !st.Last.IsZero() && elapsed <= MaxGap {
+		st.Total = st.Total.Add(st.Prev.Add(flows, 1), elapsed.Hours()/2)
+	}
+	st.Last, st.Prev = now, flows
+
+	// The interval crossing midnight is counted for the previous day
+	if day := startOfDay(now); !day.Equal(st.DayStart) {
+		st.DayStart, st.DayBase = day, st.Total
+	}
+	if month := startOfMonth(now); !month.Equal(st.MonthStart) {
+		st.MonthStart, st.MonthBase = month, st.Total
+	}
+
+	if i.filename != "" {
+		if err := statefile.Save(i.filename, i.state); err != nil {
+			log.Error("Unable to persist energy counters", "err", err)
+		}
+	}
+
+	total := st.Total
+	return []*write.Point{
+		influxdb2.NewPointWithMeasurement("energy").
+			AddField("pv", total.PV).
+			AddField("load", total.Load).
+			AddField("grid_import", total.GridImport).
+			AddField("grid_export", total.GridExport).
+			AddField("battery_charge", total.BatteryCharge).
+			AddField("battery_discharge", total.BatteryDischarge).
+			AddField("self_consumption", total.SelfConsumption).
+			AddField("direct_consumption", total.DirectConsumption).
+			AddField("battery_contribution", total.BatteryContribution).
+			SetTime(now),
+	}
+}
+
+// CountersAt returns the counters if the sample of time t was integrated. It
+// reports false for samples ignored by the integrator, or not observed yet:
+// power observers reading the counters must be registered after the
+// integrator.
+func (i *Integrator) CountersAt(t time.Time) (Counters, bool) {
+	counters := i.Counters()
+	return counters, counters.Time.Equal(t)
+}
+
+// Counters returns the current counters.
+func (i *Integrator) Counters() Counters {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	st := i.state
+	return Counters{
+		Time:       st.Last,
+		Power:      st.Prev,
+		Total:      st.Total,
+		DayStart:   st.DayStart,
+		Day:        st.Total.Sub(st.DayBase),
+		MonthStart: st.MonthStart,
+		Month:      st.Total.Sub(st.MonthBase),
+	}
+}
+
+func startOfDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+func startOfMonth(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location())
+}
@@ -0,0 +1,74 @@
+package energy
+
+import (
+	"math"
+	"path/filepath"
+	"solarizer/solarweb"
+	"testing"
+	"time"
+)
+
+func TestFromSample(t *testing.T) {
+	// 3 kW PV: 1 kW into the battery, 0.5 kW into the grid, 1.5 kW to the load
+	f := FromSample(solarweb.CompareData{PowerPV: 3000, PowerBattery: -1000, PowerGrid: -500, PowerLoad: -1500})
+	if f.SelfConsumption != 2500 || f.DirectConsumption != 1500 || f.BatteryCharge != 1000 || f.GridExport != 500 {
+		t.Fatalf("flows = %+v, want self consumption 2500 W and direct consumption 1500 W", f)
+	}
+
+	// Night: 400 W load, 300 W from the battery, 100 W from the grid
+	f = FromSample(solarweb.CompareData{PowerBattery: 300, PowerGrid: 100, PowerLoad: -400})
+	if f.BatteryContribution != 300 || f.GridImport != 100 || f.Load != 400 {
+		t.Fatalf("flows = %+v, want battery contribution 300 W", f)
+	}
+}
+
+func TestIntegratorIsGapAwareAndPersistent(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "energy.json")
+	integrator, err := Open(filename)
+	if err != nil {
+		t.Fatalf("Open returned error: %v", err)
+	}
+
+	start := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	integrator.ObservePower(start, solarweb.CompareData{PowerPV: 1000})
+	integrator.ObservePower(start.Add(time.Minute), solarweb.CompareData{PowerPV: 3000})
+	// Gaps and old samples are not integrated
+	integrator.ObservePower(start.Add(time.Hour), solarweb.CompareData{PowerPV: 3000})
+	integrator.ObservePower(start.Add(30*time.Minute), solarweb.CompareData{PowerPV: 3000})
+	if got, want := integrator.Counters().Total.PV, 2000.0/60; math.Abs(got-want) > 1e-9 {
+		t.Fatalf("total PV = %v Wh, want %v", got, want)
+	}
+
+	// A restarted integrator continues with the persisted counters
+	integrator, err = Open(filename)
+	if err != nil {
+		t.Fatalf("Open returned error: %v", err)
+	}
+	points := integrator.ObservePower(start.Add(time.Hour+time.Minute), solarweb.CompareData{PowerPV: 3000})
+	if len(points) != 1 || points[0].Name() != "energy" {
+		t.Fatalf("points = %v, want one energy point", points)
+	}
+	if got, want := integrator.Counters().Total.PV, 5000.0/60; math.Abs(got-want) > 1e-9 {
+		t.Fatalf("total PV = %v Wh, want %v", got, want)
+	}
+}
+
+func TestIntegratorResetsDayAndMonth(t *testing.T) {
+	integrator, _ := Open("")
+	start := time.Date(2025, 6, 30, 23, 59, 0, 0, time.UTC)
+	sample := solarweb.CompareData{PowerGrid: 1200, PowerLoad: -1200}
+	for i := range 4 {
+		integrator.ObservePower(start.Add(time.Duration(i)*30*time.Second), sample)
+	}
+
+	counters := integrator.Counters()
+	if !counters.DayStart.Equal(time.Date(2025, 7, 1, 0, 0, 0, 0, time.UTC)) || !counters.MonthStart.Equal(counters.DayStart) {
+		t.Fatalf("day start = %s, month start = %s, want 2025-07-01", counters.DayStart, counters.MonthStart)
+	}
+	if got := counters.Total.GridImport; math.Abs(got-30) > 1e-9 {
+		t.Fatalf("total grid import = %v Wh, want 30", got)
+	}
+	if got := counters.Day.GridImport; math.Abs(got-10) > 1e-9 {
+		t.Fatalf("day grid import = %v Wh, want 10", got)
+	}
+}
@@ -0,0 +1,141 @@
+package export
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"solarizer/history"
+	"strconv"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+// Measurements are the measurements included in an export.
+var Measurements = []string{"power", "productions", "balance"}
+
+// Table holds the exported series side by side. Columns are named
+// "measurement_field", missing values are NaN.
+type Table struct {
+	Columns []string
+	Rows    []Row
+}
+
+type Row struct {
+	Time   time.Time
+	Values []float64
+}
+
+// Collect queries all exported measurements between from and to in buckets of
+// length every. Timestamps are in the location of from.
+func Collect(ctx context.Context, source history.Source, from time.Time, to time.Time, every time.Duration) (Table, error) {
+	values := make(map[time.Time]map[string]float64)
+	var columns []string
+	for _, measurement := range Measurements {
+		series, err := source.Query(ctx, history.Query{
+			Measurement: measurement,
+			From:        from,
+			To:          to,
+			Every:       every,
+		})
+		if err != nil {
+			return Table{}, fmt.Errorf("querying %s: %w", measurement, err)
+		}
+		for _, s := range series {
+			column := measurement + "_" + s.Field
+			columns = append(columns, column)
+			for _, point := range s.Points {
+				t := point.Time.In(from.Location())
+				if values[t] == nil {
+					values[t] = make(map[string]float64)
+				}
+				values[t][column] = point.Value
+			}
+		}
+	}
+
+	table := Table{Columns: columns}
+	for t, byColumn := range values {
+		row := Row{Time: t, Values: make([]float64, len(columns))}
+		for i, column := range columns {
+			value, ok := byColumn[column]
+			if !ok {
+				value = math.NaN()
+			}
+			row.Values[i] = value
+		}
+		table.Rows = append(table.Rows, row)
+	}
+	slices.SortFunc(table.Rows, func(a, b Row) int { return a.Time.Compare(b.Time) })
+	return table, nil
+}
+
+// WriteCSV writes the table with a header line. Timestamps are written in
+// RFC 3339 format including the offset, missing values are left empty.
+func WriteCSV(w io.Writer, table Table) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(append([]string{"time"}, table.Columns...)); err != nil {
+		return err
+	}
+	record := make([]string, len(table.Columns)+1)
+	for _, row := range table.Rows {
+		record[0] = row.Time.Format(time.RFC3339)
+		for i, value := range row.Values {
+			if math.IsNaN(value) {
+				record[i+1] = ""
+			} else {
+				record[i+1] = strconv.FormatFloat(value, 'f', -1, 64)
+			}
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// WriteParquet writes the table as Parquet file. The time column is a UTC
+// adjusted timestamp in milliseconds, the name of the time zone is kept in the
+// column "timezone". Missing values are null.
+func WriteParquet(w io.Writer, table Table) error {
+	group := parquet.Group{
+		"time":     parquet.Timestamp(parquet.Millisecond),
+		"timezone": parquet.String(),
+	}
+	for _, column := range table.Columns {
+		group[column] = parquet.Optional(parquet.Leaf(parquet.DoubleType))
+	}
+	schema := parquet.NewSchema("solarizer", group)
+
+	// Columns of a group are ordered by name
+	indexes := make(map[string]int)
+	for i, path := range schema.Columns() {
+		indexes[path[0]] = i
+	}
+
+	writer := parquet.NewWriter(w, schema)
+	rows := make([]parquet.Row, 0, len(table.Rows))
+	for _, row := range table.Rows {
+		values := make(parquet.Row, len(indexes))
+		values[indexes["time"]] = parquet.Int64Value(row.Time.UnixMilli()).Level(0, 0, indexes["time"])
+		zone := row.Time.Location().String()
+		values[indexes["timezone"]] = parquet.ByteArrayValue([]byte(zone)).Level(0, 0, indexes["timezone"])
+		for i, column := range table.Columns {
+			index := indexes[column]
+			if math.IsNaN(row.Values[i]) {
+				values[index] = parquet.NullValue().Level(0, 0, index)
+			} else {
+				values[index] = parquet.DoubleValue(row.Values[i]).Level(0, 1, index)
+			}
+		}
+		rows = append(rows, values)
+	}
+	if _, err := writer.WriteRows(rows); err != nil {
+		return err
+	}
+	return writer.Close()
+}
@@ -0,0 +1,66 @@
+package export
+
+import (
+	"bytes"
+	"context"
+	"solarizer/history"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+type fakeSource map[string][]history.Series
+
+func (f fakeSource) Query(_ context.Context, query history.Query) ([]history.Series, error) {
+	return f[query.Measurement], nil
+}
+
+func TestExport(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip("time zone database not available")
+	}
+	from := time.Date(2025, 6, 1, 0, 0, 0, 0, berlin)
+	source := fakeSource{
+		"power": {{Field: "power_pv", Points: []history.Point{
+			{Time: from.UTC(), Value: 100},
+			{Time: from.Add(time.Hour).UTC(), Value: 250.5},
+		}}},
+		"balance": {{Field: "kwh_to_grid_today", Points: []history.Point{
+			{Time: from.Add(time.Hour), Value: 1.5},
+		}}},
+	}
+
+	table, err := Collect(context.Background(), source, from, from.Add(2*time.Hour), time.Hour)
+	if err != nil {
+		t.Fatalf("Collect returned error: %v", err)
+	}
+
+	var csvBuf bytes.Buffer
+	if err := WriteCSV(&csvBuf, table); err != nil {
+		t.Fatalf("WriteCSV returned error: %v", err)
+	}
+	wantCSV := strings.Join([]string{
+		"time,power_power_pv,balance_kwh_to_grid_today",
+		"2025-06-01T00:00:00+02:00,100,",
+		"2025-06-01T01:00:00+02:00,250.5,1.5",
+		"",
+	}, "\n")
+	if csvBuf.String() != wantCSV {
+		t.Fatalf("CSV = %q, want %q", csvBuf.String(), wantCSV)
+	}
+
+	var parquetBuf bytes.Buffer
+	if err := WriteParquet(&parquetBuf, table); err != nil {
+		t.Fatalf("WriteParquet returned error: %v", err)
+	}
+	file, err := parquet.OpenFile(bytes.NewReader(parquetBuf.Bytes()), int64(parquetBuf.Len()))
+	if err != nil {
+		t.Fatalf("unable to open written Parquet file: %v", err)
+	}
+	if got := file.NumRows(); got != 2 {
+		t.Fatalf("NumRows() = %d, want 2", got)
+	}
+}
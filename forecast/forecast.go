@@ -0,0 +1,226 @@
+package forecast
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"solarizer/history"
+	"solarizer/solarweb"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/log"
+	influxdb2 "github.com/influxdata/influxdb-client-go/v2"
+	"github.com/influxdata/influxdb-client-go/v2/api/write"
+)
+
+const (
+	// step is the resolution of the forecast
+	step = 15 * time.Minute
+	// defaultEfficiency is the ratio of the actual to the modelled clear-sky
+	// power before the first calibration
+	defaultEfficiency = 0.8
+	// minCalibrationRatio is the share of the peak power the modelled power
+	// of an hour must reach to be used for calibration, low sun positions
+	// are dominated by shading and the model's error
+	minCalibrationRatio = 0.2
+	// clearSkyPercentile of the hourly ratios is assumed to be clear sky
+	clearSkyPercentile = 0.9
+)
+
+// ErrNoHistory is returned by Calibrate if the history contains no production
+// at times the model expects any.
+var ErrNoHistory = errors.New("no production in history")
+
+// Calibration scales the clear-sky model to the system.
+type Calibration struct {
+	Time       time.Time `json:"time"`       // zero if not calibrated yet
+	Days       int       `json:"days"`       // days of history used
+	Efficiency float64   `json:"efficiency"` // actual to modelled power under clear sky
+	Weather    float64   `json:"weather"`    // median actual to clear-sky production of the days
+}
+
+// Point is the forecast power at a time in W.
+type Point struct {
+	Time     time.Time `json:"time"`
+	ClearSky float64   `json:"clear_sky"`
+	Expected float64   `json:"expected"` // clear sky scaled by the weather factor
+}
+
+// Day is the forecast of a day, energy in Wh.
+type Day struct {
+	Date     string  `json:"date"`
+	ClearSky float64 `json:"clear_sky"`
+	Expected float64 `json:"expected"`
+	Points   []Point `json:"points"`
+}
+
+// Forecast of today and tomorrow.
+type Forecast struct {
+	Time        time.Time   `json:"time"`
+	Calibration Calibration `json:"calibration"`
+	Today       Day         `json:"today"`
+	Tomorrow    Day         `json:"tomorrow"`
+}
+
+// Forecaster forecasts the production with a clear-sky model of the system,
+// calibrated with the production stored in the history. It implements
+// influx.PowerObserver to write the forecast next to the actual power.
+type Forecaster struct {
+	system  System
+	history history.Source // optional, the model is not calibrated without
+	days    int            // days of history used for calibration
+
+	mu          sync.Mutex
+	calibration Calibration
+}
+
+// New creates a forecaster calibrated with the given days of history.
+func New(system System, source history.Source, days int) *Forecaster {
+	return &Forecaster{
+		system:      system,
+		history:     source,
+		days:        days,
+		calibration: Calibration{Efficiency: defaultEfficiency, Weather: 1},
+	}
+}
+
+// Run calibrates the model at startup and once a day until ctx is cancelled.
+func (f *Forecaster) Run(ctx context.Context) {
+	if f.history == nil {
+		return
+	}
+	ticker := time.NewTicker(24 * time.Hour)
+	defer ticker.Stop()
+	for {
+		if err := f.Calibrate(ctx, time.Now()); err != nil && ctx.Err() == nil {
+			log.Warn("Unable to calibrate forecast", "err", err)
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Calibrate compares the hourly mean production of the days before now with
+// the model. Most hours with clouds produce less than the model, so a high
+// percentile of the ratios is taken as the efficiency under clear sky. The
+// median ratio of the daily production to the calibrated clear-sky production
+// is used as weather factor of the expected production.
+func (f *Forecaster) Calibrate(ctx context.Context, now time.Time) error {
+	today := startOfDay(now)
+	series, err := f.history.Query(ctx, history.Query{
+		Measurement: "power",
+		Fields:      []string{"power_pv"},
+		From:        today.AddDate(0, 0, -f.days),
+		To:          today,
+		Every:       time.Hour,
+	})
+	if err != nil {
+		return err
+	}
+	if len(series) == 0 {
+		return ErrNoHistory
+	}
+
+	var ratios []float64
+	actual := make(map[time.Time]float64)
+	for _, point := range series[0].Points {
+		modelled := f.system.clearSky(point.Time.Add(30 * time.Minute))
+		if modelled >= minCalibrationRatio*f.system.PeakPower {
+			ratios = append(ratios, max(point.Value, 0)/modelled)
+		}
+		actual[startOfDay(point.Time.In(now.Location()))] += max(point.Value, 0) // hourly mean in W is Wh
+	}
+	if len(ratios) == 0 || slices.Max(ratios) == 0 {
+		return ErrNoHistory
+	}
+	slices.Sort(ratios)
+	efficiency := ratios[int(clearSkyPercentile*float64(len(ratios)-1))]
+	if efficiency <= 0 {
+		return ErrNoHistory // too few hours with production
+	}
+
+	var weather []float64
+	for day, production := range actual {
+		if clearSky := f.clearSkyEnergy(day) * efficiency; clearSky > 0 {
+			weather = append(weather, min(production/clearSky, 1))
+		}
+	}
+	if len(weather) == 0 {
+		return ErrNoHistory
+	}
+	slices.Sort(weather)
+
+	f.mu.Lock()
+	f.calibration = Calibration{
+		Time:       now,
+		Days:       len(actual),
+		Efficiency: efficiency,
+		Weather:    weather[len(weather)/2],
+	}
+	log.Info("Calibrated forecast", "days", f.calibration.Days, "efficiency", f.calibration.Efficiency, "weather", f.calibration.Weather)
+	f.mu.Unlock()
+	return nil
+}
+
+// Forecast returns the forecast of today and tomorrow in the location of now.
+func (f *Forecaster) Forecast(now time.Time) Forecast {
+	f.mu.Lock()
+	calibration := f.calibration
+	f.mu.Unlock()
+	today := startOfDay(now)
+	return Forecast{
+		Time:        now,
+		Calibration: calibration,
+		Today:       f.day(today, calibration),
+		Tomorrow:    f.day(today.AddDate(0, 0, 1), calibration),
+	}
+}
+
+// ObservePower returns the measurement "forecast" with the forecast power at
+// the time of the sample and the expected production of the day.
+func (f *Forecaster) ObservePower(now time.Time, _ solarweb.CompareData) []*write.Point {
+	f.mu.Lock()
+	calibration := f.calibration
+	f.mu.Unlock()
+	clearSky := f.system.clearSky(now) * calibration.Efficiency
+	return []*write.Point{
+		influxdb2.NewPointWithMeasurement("forecast").
+			AddField("clear_sky", clearSky).
+			AddField("expected", clearSky*calibration.Weather).
+			AddField("day_expected", f.day(startOfDay(now), calibration).Expected).
+			SetTime(now),
+	}
+}
+
+// day integrates the model over the day with the trapezoidal rule.
+func (f *Forecaster) day(start time.Time, calibration Calibration) Day {
+	d := Day{Date: start.Format(time.DateOnly)}
+	end := start.AddDate(0, 0, 1)
+	for t := start; !t.After(end); t = t.Add(step) {
+		clearSky := f.system.clearSky(t) * calibration.Efficiency
+		point := Point{Time: t, ClearSky: clearSky, Expected: clearSky * calibration.Weather}
+		if len(d.Points) > 0 {
+			prev := d.Points[len(d.Points)-1]
+			d.ClearSky += (prev.ClearSky + point.ClearSky) / 2 * step.Hours()
+			d.Expected += (prev.Expected + point.Expected) / 2 * step.Hours()
+		}
+		if t.Before(end) {
+			d.Points = append(d.Points, point)
+		}
+	}
+	return d
+}
+
+// clearSkyEnergy returns the modelled production of the day with an
+// efficiency of 1 in Wh.
+func (f *Forecaster) clearSkyEnergy(day time.Time) float64 {
+	return f.day(day, Calibration{Efficiency: 1, Weather: 1}).ClearSky
+}
+
+func startOfDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
@@ -0,0 +1,91 @@
+package forecast
+
+import (
+	"context"
+	"math"
+	"solarizer/history"
+	"testing"
+	"time"
+)
+
+var vienna = System{Latitude: 48.2, Longitude: 16.37, Tilt: 30, Azimuth: 180, PeakPower: 10000}
+
+// fakeHistory returns the hourly mean of the model scaled by a factor per day.
+type fakeHistory struct {
+	system  System
+	factors []float64
+}
+
+func (h fakeHistory) Query(_ context.Context, query history.Query) ([]history.Series, error) {
+	series := history.Series{Field: "power_pv"}
+	for i, factor := range h.factors {
+		day := query.From.AddDate(0, 0, i)
+		for t := day; t.Before(day.AddDate(0, 0, 1)); t = t.Add(time.Hour) {
+			series.Points = append(series.Points, history.Point{Time: t, Value: h.system.clearSky(t.Add(30*time.Minute)) * factor})
+		}
+	}
+	return []history.Series{series}, nil
+}
+
+func TestClearSkyModel(t *testing.T) {
+	cest := time.FixedZone("CEST", 2*60*60)
+	if p := vienna.clearSky(time.Date(2025, 6, 21, 3, 0, 0, 0, cest)); p != 0 {
+		t.Errorf("power before sunrise = %.0f W, want 0", p)
+	}
+	// Solar noon in Vienna is around 12:56 CEST
+	noon := vienna.clearSky(time.Date(2025, 6, 21, 12, 56, 0, 0, cest))
+	if noon < 9000 || noon > 11000 {
+		t.Errorf("power at solar noon = %.0f W, want close to the peak power", noon)
+	}
+	morning := vienna.clearSky(time.Date(2025, 6, 21, 9, 56, 0, 0, cest))
+	afternoon := vienna.clearSky(time.Date(2025, 6, 21, 15, 56, 0, 0, cest))
+	if math.Abs(morning-afternoon) > 0.02*noon {
+		t.Errorf("power 3 hours before and after solar noon = %.0f W and %.0f W, want symmetric", morning, afternoon)
+	}
+	west := vienna
+	west.Azimuth = 270
+	if west.clearSky(time.Date(2025, 6, 21, 10, 5, 0, 0, cest)) >= west.clearSky(time.Date(2025, 6, 21, 16, 5, 0, 0, cest)) {
+		t.Error("west facing array produces more in the morning than in the afternoon")
+	}
+}
+
+func TestCalibrate(t *testing.T) {
+	now := time.Date(2025, 6, 4, 9, 0, 0, 0, time.UTC)
+	// One sunny day at 75 % of the model and two cloudy days
+	forecaster := New(vienna, fakeHistory{system: vienna, factors: []float64{0.375, 0.75, 0.375}}, 3)
+	if err := forecaster.Calibrate(context.Background(), now); err != nil {
+		t.Fatal(err)
+	}
+	forecast := forecaster.Forecast(now)
+	calibration := forecast.Calibration
+	if calibration.Days != 3 || math.Abs(calibration.Efficiency-0.75) > 1e-9 || math.Abs(calibration.Weather-0.5) > 0.02 {
+		t.Fatalf("calibration = %+v, want 3 days, efficiency 0.75 and weather 0.5", calibration)
+	}
+	today := forecast.Today
+	if today.Date != "2025-06-04" || len(today.Points) != 96 || forecast.Tomorrow.Date != "2025-06-05" {
+		t.Fatalf("forecast of %s with %d points and of %s", today.Date, len(today.Points), forecast.Tomorrow.Date)
+	}
+	if math.Abs(today.Expected-today.ClearSky*calibration.Weather) > 1e-6 || today.ClearSky < 50000 {
+		t.Fatalf("today = %.0f Wh clear sky and %.0f Wh expected", today.ClearSky, today.Expected)
+	}
+}
+
+func TestCalibrateWithoutProduction(t *testing.T) {
+	forecaster := New(vienna, fakeHistory{system: vienna, factors: []float64{0, 0}}, 2)
+	if err := forecaster.Calibrate(context.Background(), time.Date(2025, 6, 4, 9, 0, 0, 0, time.UTC)); err != ErrNoHistory {
+		t.Fatalf("Calibrate returned %v, want ErrNoHistory", err)
+	}
+	if calibration := forecaster.Forecast(time.Now()).Calibration; !calibration.Time.IsZero() || calibration.Efficiency != defaultEfficiency {
+		t.Fatalf("calibration = %+v, want default", calibration)
+	}
+}
+
+func TestCalibrateWithMostlyZeroProduction(t *testing.T) {
+	// Only one of 20 days produced, so the percentile of the ratios is zero
+	factors := make([]float64, 20)
+	factors[10] = 0.8
+	forecaster := New(vienna, fakeHistory{system: vienna, factors: factors}, len(factors))
+	if err := forecaster.Calibrate(context.Background(), time.Date(2025, 6, 21, 9, 0, 0, 0, time.UTC)); err != ErrNoHistory {
+		t.Fatalf("Calibrate returned %v, want ErrNoHistory", err)
+	}
+}
@@ -0,0 +1,62 @@
+package forecast
+
+import (
+	"math"
+	"time"
+)
+
+// System describes the PV array.
+type System struct {
+	Latitude  float64 // degrees, north positive
+	Longitude float64 // degrees, east positive
+	Tilt      float64 // degrees from horizontal
+	Azimuth   float64 // degrees clockwise from north, 180 is south
+	PeakPower float64 // Wp
+}
+
+// sunVector returns the direction of the sun as east, north and up
+// components of a unit vector, using the NOAA approximation of the
+// declination and the equation of time.
+func sunVector(t time.Time, latitude float64, longitude float64) (float64, float64, float64) {
+	t = t.UTC()
+	hours := float64(t.Hour()) + float64(t.Minute())/60 + float64(t.Second())/3600
+	gamma := 2 * math.Pi / 365 * (float64(t.YearDay()-1) + (hours-12)/24)
+	eqTime := 229.18 * (0.000075 + 0.001868*math.Cos(gamma) - 0.032077*math.Sin(gamma) -
+		0.014615*math.Cos(2*gamma) - 0.040849*math.Sin(2*gamma))
+	declination := 0.006918 - 0.399912*math.Cos(gamma) + 0.070257*math.Sin(gamma) -
+		0.006758*math.Cos(2*gamma) + 0.000907*math.Sin(2*gamma) -
+		0.002697*math.Cos(3*gamma) + 0.00148*math.Sin(3*gamma)
+	trueSolarTime := hours*60 + eqTime + 4*longitude // minutes
+	hourAngle := radians(trueSolarTime/4 - 180)
+	lat := radians(latitude)
+
+	east := -math.Cos(declination) * math.Sin(hourAngle)
+	north := math.Cos(lat)*math.Sin(declination) - math.Sin(lat)*math.Cos(declination)*math.Cos(hourAngle)
+	up := math.Sin(lat)*math.Sin(declination) + math.Cos(lat)*math.Cos(declination)*math.Cos(hourAngle)
+	return east, north, up
+}
+
+// clearSky returns the power of the system at t under clear sky with an
+// efficiency of 1. The direct irradiance follows Meinel with the air mass of
+// Kasten and Young, the diffuse irradiance is assumed to be a tenth of it.
+func (s System) clearSky(t time.Time) float64 {
+	east, north, up := sunVector(t, s.Latitude, s.Longitude)
+	if up <= 0 {
+		return 0
+	}
+	zenith := math.Acos(up) * 180 / math.Pi
+	airMass := 1 / (up + 0.50572*math.Pow(96.07995-zenith, -1.6364))
+	direct := 1353 * math.Pow(0.7, math.Pow(airMass, 0.678))
+	diffuse := 0.1 * direct
+	global := direct*up + diffuse
+
+	tilt, azimuth := radians(s.Tilt), radians(s.Azimuth)
+	cosIncidence := east*math.Sin(tilt)*math.Sin(azimuth) + north*math.Sin(tilt)*math.Cos(azimuth) + up*math.Cos(tilt)
+	const albedo = 0.2
+	plane := direct*max(cosIncidence, 0) + diffuse*(1+math.Cos(tilt))/2 + global*albedo*(1-math.Cos(tilt))/2
+	return s.PeakPower * plane / 1000
+}
+
+func radians(degrees float64) float64 {
+	return degrees * math.Pi / 180
+}
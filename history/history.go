@@ -0,0 +1,33 @@
+package history
+
+import (
+	"context"
+	"time"
+)
+
+// Source answers history queries, e.g. from the local SQLite store.
+type Source interface {
+	Query(ctx context.Context, query Query) ([]Series, error)
+}
+
+// Query selects the series of a measurement between From and To, aggregated
+// to the mean of buckets of length Every.
+type Query struct {
+	Measurement string
+	Fields      []string // optional, all fields if empty
+	From        time.Time
+	To          time.Time
+	Every       time.Duration
+}
+
+// Series holds the aggregated values of one field.
+type Series struct {
+	Field  string  `json:"field"`
+	Points []Point `json:"points"`
+}
+
+// Point is the mean of one bucket, Time is the start of the bucket.
+type Point struct {
+	Time  time.Time `json:"time"`
+	Value float64   `json:"value"`
+}
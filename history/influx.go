@@ -0,0 +1,112 @@
+package history
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"solarizer/influx"
+	"strings"
+	"time"
+
+	influxdb2 "github.com/influxdata/influxdb-client-go/v2"
+	"github.com/influxdata/influxdb-client-go/v2/api"
+)
+
+// InfluxSource answers history queries with Flux queries against the bucket
+// the importer writes to. InfluxDB 1.8 must have Flux enabled.
+type InfluxSource struct {
+	client   influxdb2.Client
+	queryAPI api.QueryAPI
+	bucket   string
+}
+
+// NewInfluxSource creates a source for the configured target. The token must
+// be allowed to read the bucket.
+func NewInfluxSource(config influx.DBConfig) *InfluxSource {
+	client := config.NewClient()
+	org, bucket := config.QueryTarget()
+	return &InfluxSource{
+		client:   client,
+		queryAPI: client.QueryAPI(org),
+		bucket:   bucket,
+	}
+}
+
+// Query returns the mean values per bucket. Buckets are aligned to the time
+// zone of query.From.
+func (s *InfluxSource) Query(ctx context.Context, query Query) ([]Series, error) {
+	if query.Every < time.Second {
+		return nil, fmt.Errorf("invalid interval %s", query.Every)
+	}
+	result, err := s.queryAPI.Query(ctx, fluxQuery(s.bucket, query))
+	if err != nil {
+		return nil, err
+	}
+	defer result.Close()
+
+	byField := make(map[string]*Series)
+	for result.Next() {
+		record := result.Record()
+		value, ok := numericValue(record.Value())
+		if !ok {
+			continue
+		}
+		series, ok := byField[record.Field()]
+		if !ok {
+			series = &Series{Field: record.Field()}
+			byField[record.Field()] = series
+		}
+		series.Points = append(series.Points, Point{Time: record.Time().In(query.From.Location()), Value: value})
+	}
+	if result.Err() != nil {
+		return nil, result.Err()
+	}
+
+	series := make([]Series, 0, len(byField))
+	for _, s := range byField {
+		slices.SortFunc(s.Points, func(a, b Point) int { return a.Time.Compare(b.Time) })
+		series = append(series, *s)
+	}
+	slices.SortFunc(series, func(a, b Series) int { return strings.Compare(a.Field, b.Field) })
+	return series, nil
+}
+
+// Close closes the influx client.
+func (s *InfluxSource) Close() {
+	s.client.Close()
+}
+
+// fluxQuery builds the query for the mean of each bucket. Series of the same
+// field with different tags are merged. Windows are shifted by the offset of
+// the time zone of query.From, so e.g. daily buckets start at local midnight.
+func fluxQuery(bucket string, query Query) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "from(bucket: %s)\n", fluxString(bucket))
+	fmt.Fprintf(&b, "  |> range(start: %s, stop: %s)\n",
+		query.From.UTC().Format(time.RFC3339Nano), query.To.UTC().Format(time.RFC3339Nano))
+	fmt.Fprintf(&b, "  |> filter(fn: (r) => r._measurement == %s)\n", fluxString(query.Measurement))
+	if len(query.Fields) > 0 {
+		conditions := make([]string, len(query.Fields))
+		for i, field := range query.Fields {
+			conditions[i] = "r._field == " + fluxString(field)
+		}
+		fmt.Fprintf(&b, "  |> filter(fn: (r) => %s)\n", strings.Join(conditions, " or "))
+	}
+	b.WriteString("  |> group(columns: [\"_field\"])\n")
+
+	every := query.Every.Milliseconds()
+	_, zoneOffset := query.From.Zone()
+	offset := ((-int64(zoneOffset)*1000)%every + every) % every
+	if offset == 0 {
+		fmt.Fprintf(&b, "  |> aggregateWindow(every: %dms, fn: mean, timeSrc: \"_start\", createEmpty: false)\n", every)
+	} else {
+		fmt.Fprintf(&b, "  |> aggregateWindow(every: %dms, offset: %dms, fn: mean, timeSrc: \"_start\", createEmpty: false)\n", every, offset)
+	}
+	return b.String()
+}
+
+// fluxString returns s as quoted Flux string literal.
+func fluxString(s string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "${", `\${`)
+	return `"` + replacer.Replace(s) + `"`
+}
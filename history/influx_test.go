@@ -0,0 +1,77 @@
+package history
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"solarizer/influx"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestInfluxSourceQuery(t *testing.T) {
+	var flux string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Query string `json:"query"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		flux = body.Query
+		w.Header().Set("Content-Type", "text/csv")
+		_, _ = w.Write([]byte(strings.Join([]string{
+			"#datatype,string,long,dateTime:RFC3339,dateTime:RFC3339,dateTime:RFC3339,double,string,string",
+			"#group,false,false,true,true,false,false,true,true",
+			"#default,_result,,,,,,,",
+			",result,table,_start,_stop,_time,_value,_field,_measurement",
+			",,0,2025-06-01T00:00:00Z,2025-06-02T00:00:00Z,2025-06-01T01:00:00Z,250.5,power_pv,power",
+			",,0,2025-06-01T00:00:00Z,2025-06-02T00:00:00Z,2025-06-01T00:00:00Z,100,power_pv,power",
+			",,1,2025-06-01T00:00:00Z,2025-06-02T00:00:00Z,2025-06-01T00:00:00Z,-300,power_load,power",
+			"",
+		}, "\r\n")))
+	}))
+	defer server.Close()
+
+	source := NewInfluxSource(influx.DBConfig{Url: server.URL, Token: "token", Org: "org", Bucket: "solar"})
+	defer source.Close()
+	berlin := time.FixedZone("CEST", 2*60*60)
+	from := time.Date(2025, 6, 1, 2, 0, 0, 0, berlin)
+	series, err := source.Query(context.Background(), Query{
+		Measurement: "power",
+		Fields:      []string{"power_pv", "power_load"},
+		From:        from,
+		To:          from.Add(24 * time.Hour),
+		Every:       24 * time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("Query returned error: %v", err)
+	}
+
+	for _, want := range []string{
+		`from(bucket: "solar")`,
+		`range(start: 2025-06-01T00:00:00Z, stop: 2025-06-02T00:00:00Z)`,
+		`r._field == "power_pv" or r._field == "power_load"`,
+		`aggregateWindow(every: 86400000ms, offset: 79200000ms, fn: mean`,
+	} {
+		if !strings.Contains(flux, want) {
+			t.Errorf("query %q does not contain %q", flux, want)
+		}
+	}
+	if len(series) != 2 || series[0].Field != "power_load" || series[1].Field != "power_pv" {
+		t.Fatalf("series = %+v, want power_load and power_pv", series)
+	}
+	pv := series[1].Points
+	if len(pv) != 2 || pv[0].Value != 100 || pv[1].Value != 250.5 {
+		t.Fatalf("power_pv = %+v, want 100 and 250.5 in time order", pv)
+	}
+	if got := pv[0].Time.Format(time.RFC3339); got != "2025-06-01T02:00:00+02:00" {
+		t.Fatalf("time = %s, want time in the zone of from", got)
+	}
+}
+
+func TestFluxString(t *testing.T) {
+	if got, want := fluxString(`a"b\c${d}`), `"a\"b\\c\${d}"`; got != want {
+		t.Fatalf("fluxString = %s, want %s", got, want)
+	}
+}
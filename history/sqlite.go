@@ -0,0 +1,280 @@
+package history
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"solarizer/influx"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/influxdata/influxdb-client-go/v2/api/write"
+	_ "modernc.org/sqlite"
+)
+
+const maintenanceInterval = time.Hour
+
+// Numeric fields are stored in a narrow table with one row per measurement,
+// field and time. Tags and string fields are not stored. Raw samples older
+// than the raw retention are downsampled into hourly mean, min and max values.
+const schema = `
+CREATE TABLE IF NOT EXISTS samples (
+	measurement TEXT NOT NULL,
+	field       TEXT NOT NULL,
+	time        INTEGER NOT NULL, -- unix milliseconds
+	value       REAL NOT NULL
+);
+CREATE INDEX IF NOT EXISTS samples_idx ON samples (measurement, field, time);
+CREATE TABLE IF NOT EXISTS samples_hourly (
+	measurement TEXT NOT NULL,
+	field       TEXT NOT NULL,
+	hour        INTEGER NOT NULL, -- unix milliseconds of the start of the hour
+	mean        REAL NOT NULL,
+	min         REAL NOT NULL,
+	max         REAL NOT NULL,
+	count       INTEGER NOT NULL,
+	PRIMARY KEY (measurement, field, hour)
+);
+`
+
+type Config struct {
+	Filename        string
+	RawRetention    time.Duration // raw samples are downsampled after this duration
+	HourlyRetention time.Duration // hourly values are deleted after this duration, kept forever if zero
+}
+
+// Store persists every point written by the importer in a local SQLite
+// database and answers history queries from it.
+type Store struct {
+	influx.SinkState
+	config Config
+	db     *sql.DB
+	mu     sync.Mutex
+	stop   chan struct{}
+	done   chan struct{}
+}
+
+// Open opens or creates the SQLite database.
+func Open(config Config) (*Store, error) {
+	if err := os.MkdirAll(filepath.Dir(config.Filename), 0700); err != nil {
+		return nil, err
+	}
+	dsn := "file:" + config.Filename + "?_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)"
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(schema); err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("unable to create history schema: %w", err)
+	}
+
+	s := &Store{
+		config: config,
+		db:     db,
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	go s.runMaintenanceLoop()
+	return s, nil
+}
+
+func (s *Store) Name() string {
+	return "history"
+}
+
+// WritePoint stores all numeric fields of the point. Local inserts are fast
+// enough to be done synchronously.
+func (s *Store) WritePoint(point *write.Point) {
+	s.RecordPoint()
+	if err := s.insert(point); err != nil {
+		log.Error("Error writing to history", "err", err)
+		s.RecordError(err)
+		s.UpdateStats(func(stats *influx.Stats) { stats.Discarded++ })
+	}
+}
+
+func (s *Store) insert(point *write.Point) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, field := range point.FieldList() {
+		value, ok := numericValue(field.Value)
+		if !ok {
+			continue
+		}
+		_, err := tx.Exec("INSERT INTO samples (measurement, field, time, value) VALUES (?, ?, ?, ?)",
+			point.Name(), field.Key, point.Time().UnixMilli(), value)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Status reports whether the database can be accessed.
+func (s *Store) Status(ctx context.Context) influx.Status {
+	st := s.State(s.Name())
+	err := s.db.PingContext(ctx)
+	st.Reachable = err == nil
+	if err != nil {
+		st.PingError = err.Error()
+	}
+	return st
+}
+
+// Close stops the maintenance and closes the database.
+func (s *Store) Close() {
+	close(s.stop)
+	<-s.done
+	if err := s.db.Close(); err != nil {
+		log.Error("Unable to close history", "err", err)
+	}
+}
+
+// Query returns the mean values per bucket, combining raw samples and hourly
+// values. Buckets are aligned to the time zone of query.From.
+func (s *Store) Query(ctx context.Context, query Query) ([]Series, error) {
+	if query.Every < time.Second {
+		return nil, fmt.Errorf("invalid interval %s", query.Every)
+	}
+	_, offset := query.From.Zone()
+	offsetMs := int64(offset) * 1000
+	everyMs := query.Every.Milliseconds()
+
+	fieldFilter := ""
+	if len(query.Fields) > 0 {
+		fieldFilter = " AND field IN (" + strings.TrimSuffix(strings.Repeat("?, ", len(query.Fields)), ", ") + ")"
+	}
+	statement := `
+		SELECT field, ((t + ?) / ?) * ? - ? AS bucket, SUM(value * n) / SUM(n)
+		FROM (
+			SELECT field, time AS t, value, 1 AS n FROM samples
+			WHERE measurement = ? AND time >= ? AND time < ?` + fieldFilter + `
+			UNION ALL
+			SELECT field, hour AS t, mean AS value, count AS n FROM samples_hourly
+			WHERE measurement = ? AND hour >= ? AND hour < ?` + fieldFilter + `
+		)
+		GROUP BY field, bucket
+		ORDER BY field, bucket`
+	args := []any{offsetMs, everyMs, everyMs, offsetMs}
+	for range 2 {
+		// Both selects have the same filter
+		args = append(args, query.Measurement, query.From.UnixMilli(), query.To.UnixMilli())
+		for _, field := range query.Fields {
+			args = append(args, field)
+		}
+	}
+
+	rows, err := s.db.QueryContext(ctx, statement, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var series []Series
+	for rows.Next() {
+		var field string
+		var bucket int64
+		var value float64
+		if err := rows.Scan(&field, &bucket, &value); err != nil {
+			return nil, err
+		}
+		if len(series) == 0 || series[len(series)-1].Field != field {
+			series = append(series, Series{Field: field})
+		}
+		current := &series[len(series)-1]
+		current.Points = append(current.Points, Point{Time: time.UnixMilli(bucket).In(query.From.Location()), Value: value})
+	}
+	return series, rows.Err()
+}
+
+func (s *Store) runMaintenanceLoop() {
+	defer close(s.done)
+	s.maintain()
+	ticker := time.NewTicker(maintenanceInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.maintain()
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// maintain downsamples raw samples and deletes expired hourly values.
+func (s *Store) maintain() {
+	if err := s.downsample(time.Now()); err != nil {
+		log.Error("Error maintaining history", "err", err)
+	}
+}
+
+func (s *Store) downsample(now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if s.config.RawRetention > 0 {
+		// Only complete hours are downsampled, so no hour is aggregated twice
+		cutoff := now.Add(-s.config.RawRetention).Truncate(time.Hour).UnixMilli()
+		_, err = tx.Exec(`
+			INSERT INTO samples_hourly (measurement, field, hour, mean, min, max, count)
+			SELECT measurement, field, (time / 3600000) * 3600000 AS hour, AVG(value), MIN(value), MAX(value), COUNT(*)
+			FROM samples WHERE time < ?
+			GROUP BY measurement, field, hour
+			ON CONFLICT (measurement, field, hour) DO UPDATE SET
+				mean = (mean * count + excluded.mean * excluded.count) / (count + excluded.count),
+				min = MIN(min, excluded.min),
+				max = MAX(max, excluded.max),
+				count = count + excluded.count`, cutoff)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec("DELETE FROM samples WHERE time < ?", cutoff); err != nil {
+			return err
+		}
+	}
+	if s.config.HourlyRetention > 0 {
+		cutoff := now.Add(-s.config.HourlyRetention).UnixMilli()
+		if _, err := tx.Exec("DELETE FROM samples_hourly WHERE hour < ?", cutoff); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// numericValue converts field values to float64, strings are not stored.
+func numericValue(value any) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case int64:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case bool:
+		if v {
+			return 1, true
+		}
+		return 0, true
+	default:
+		return 0, false
+	}
+}
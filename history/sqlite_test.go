@@ -0,0 +1,103 @@
+package history
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	influxdb2 "github.com/influxdata/influxdb-client-go/v2"
+)
+
+func TestQueryAggregatesBuckets(t *testing.T) {
+	store := openStore(t)
+	start := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	for i, pv := range []float64{100, 200, 300, 400} {
+		store.WritePoint(influxdb2.NewPointWithMeasurement("power").
+			AddTag("is_online", "true").
+			AddField("power_pv", pv).
+			AddField("power_grid", -pv).
+			SetTime(start.Add(time.Duration(i) * 15 * time.Minute)))
+	}
+
+	series, err := store.Query(context.Background(), Query{
+		Measurement: "power",
+		Fields:      []string{"power_pv"},
+		From:        start,
+		To:          start.Add(time.Hour),
+		Every:       30 * time.Minute,
+	})
+	if err != nil {
+		t.Fatalf("Query returned error: %v", err)
+	}
+
+	if len(series) != 1 || series[0].Field != "power_pv" {
+		t.Fatalf("series = %+v, want only power_pv", series)
+	}
+	assertPoints(t, series[0].Points, []Point{
+		{Time: start, Value: 150},
+		{Time: start.Add(30 * time.Minute), Value: 350},
+	})
+}
+
+func TestDownsampleKeepsMean(t *testing.T) {
+	store := openStore(t)
+	start := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	for i, pv := range []float64{100, 200, 600} {
+		store.WritePoint(influxdb2.NewPointWithMeasurement("power").
+			AddField("power_pv", pv).
+			SetTime(start.Add(time.Duration(i) * 20 * time.Minute)))
+	}
+
+	if err := store.downsample(start.Add(store.config.RawRetention + 2*time.Hour)); err != nil {
+		t.Fatalf("downsample returned error: %v", err)
+	}
+	var raw int
+	if err := store.db.QueryRow("SELECT COUNT(*) FROM samples").Scan(&raw); err != nil {
+		t.Fatal(err)
+	}
+	if raw != 0 {
+		t.Fatalf("%d raw samples left after downsampling, want 0", raw)
+	}
+
+	series, err := store.Query(context.Background(), Query{
+		Measurement: "power",
+		From:        start,
+		To:          start.Add(time.Hour),
+		Every:       time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("Query returned error: %v", err)
+	}
+	if len(series) != 1 {
+		t.Fatalf("series = %+v, want one series", series)
+	}
+	assertPoints(t, series[0].Points, []Point{{Time: start, Value: 300}})
+}
+
+func openStore(t *testing.T) *Store {
+	t.Helper()
+
+	store, err := Open(Config{
+		Filename:     filepath.Join(t.TempDir(), "history.db"),
+		RawRetention: 24 * time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("Open returned error: %v", err)
+	}
+	t.Cleanup(store.Close)
+	return store
+}
+
+func assertPoints(t *testing.T, got []Point, want []Point) {
+	t.Helper()
+
+	if len(got) != len(want) {
+		t.Fatalf("points = %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if !got[i].Time.Equal(want[i].Time) || got[i].Value != want[i].Value {
+			t.Fatalf("points = %+v, want %+v", got, want)
+		}
+	}
+}
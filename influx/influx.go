@@ -3,14 +3,16 @@ package influx
 import (
 	"bytes"
 	"context"
+	"encoding/json"
+	"fmt"
 	"solarizer/solarweb"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/charmbracelet/log"
 	influxdb2 "github.com/influxdata/influxdb-client-go/v2"
-	influxdb2api "github.com/influxdata/influxdb-client-go/v2/api"
 	"github.com/influxdata/influxdb-client-go/v2/api/write"
 	lp "github.com/influxdata/line-protocol"
 )
@@ -20,32 +22,49 @@ const (
 	slowInterval = 5 * time.Minute
 )
 
-type DBConfig struct {
-	Url    string
-	Token  string
-	Org    string
-	Bucket string
+// PowerObserver derives additional points from the power samples, e.g. KPIs
+// or integrated energy. ObservePower is called sequentially for every sample.
+type PowerObserver interface {
+	ObservePower(t time.Time, data solarweb.CompareData) []*write.Point
 }
 
 type Importer struct {
-	influxClient   influxdb2.Client
-	influxWriteAPI influxdb2api.WriteAPI
+	sinks          []Sink
+	observers      []PowerObserver
+	powerMu        sync.Mutex // serializes power samples for the observers
 	solarWebClient *solarweb.SolarWeb
+
+	// fetchCtx is passed to all fetches and cancelled if they do not finish
+	// within the shutdown deadline
+	fetchCtx     context.Context
+	cancelFetch  context.CancelFunc
+	fetchMu      sync.Mutex
+	fetchWg      sync.WaitGroup
+	shuttingDown bool
 }
 
-func NewImporter(dbConfig DBConfig, solarWebClient *solarweb.SolarWeb) *Importer {
-	client := influxdb2.NewClientWithOptions(dbConfig.Url, dbConfig.Token, influxdb2.DefaultOptions())
-	writeAPI := client.WriteAPI(dbConfig.Org, dbConfig.Bucket)
+// NewImporter creates an importer writing every point to all sinks.
+func NewImporter(solarWebClient *solarweb.SolarWeb, sinks ...Sink) *Importer {
+	fetchCtx, cancelFetch := context.WithCancel(context.Background())
 	return &Importer{
-		influxClient:   client,
-		influxWriteAPI: writeAPI,
+		sinks:          sinks,
 		solarWebClient: solarWebClient,
+		fetchCtx:       fetchCtx,
+		cancelFetch:    cancelFetch,
 	}
 }
 
+// AddPowerObserver registers an observer for all following power samples.
+// It must be called before the import loop is started.
+func (i *Importer) AddPowerObserver(observer PowerObserver) {
+	i.observers = append(i.observers, observer)
+}
+
 func (i *Importer) RunImportLoop(ctx context.Context) {
 	fastTicker := time.NewTicker(fastInterval)
+	defer fastTicker.Stop()
 	slowTicker := time.NewTicker(slowInterval)
+	defer slowTicker.Stop()
 	for {
 		select {
 		case <-fastTicker.C:
@@ -58,39 +77,160 @@ func (i *Importer) RunImportLoop(ctx context.Context) {
 	}
 }
 
+// Status returns the health of all sinks.
+func (i *Importer) Status(ctx context.Context) []Status {
+	statuses := make([]Status, 0, len(i.sinks))
+	for _, sink := range i.sinks {
+		statuses = append(statuses, sink.Status(ctx))
+	}
+	return statuses
+}
+
+// Stats returns the write counters of all sinks by sink name.
+func (i *Importer) Stats() map[string]Stats {
+	stats := make(map[string]Stats, len(i.sinks))
+	for _, sink := range i.sinks {
+		stats[sink.Name()] = sink.Stats()
+	}
+	return stats
+}
+
+// writePoint queues the point for writing to all sinks.
+func (i *Importer) writePoint(point *write.Point) {
+	logPoint(point)
+	for _, sink := range i.sinks {
+		sink.WritePoint(point)
+	}
+}
+
+// Close writes all buffered points and closes the sinks.
+func (i *Importer) Close() {
+	i.cancelFetch()
+	for _, sink := range i.sinks {
+		sink.Close()
+	}
+}
+
+// Shutdown stops new fetches and waits for in-flight fetches to finish. If ctx
+// expires first, the in-flight fetches are cancelled. Afterwards all buffered
+// points are written and the sinks are closed.
+func (i *Importer) Shutdown(ctx context.Context) error {
+	i.fetchMu.Lock()
+	i.shuttingDown = true
+	i.fetchMu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		i.fetchWg.Wait()
+		close(done)
+	}()
+
+	var err error
+	select {
+	case <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+		log.Warn("Cancelling in-flight fetches", "err", err)
+		i.cancelFetch()
+		<-done
+	}
+
+	i.Close()
+	return err
+}
+
+// goFetch runs the fetch asynchronously unless the importer is shutting down.
+func (i *Importer) goFetch(fetch func(ctx context.Context)) {
+	i.fetchMu.Lock()
+	defer i.fetchMu.Unlock()
+	if i.shuttingDown {
+		return
+	}
+	i.fetchWg.Add(1)
+	go func() {
+		defer i.fetchWg.Done()
+		fetch(i.fetchCtx)
+	}()
+}
+
+// Backfill imports the production chart of every day between from and to
+// (inclusive) into the measurement "power_history".
+func (i *Importer) Backfill(ctx context.Context, from time.Time, to time.Time) error {
+	for day := from; !day.After(to); day = day.AddDate(0, 0, 1) {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		log.Info("Backfilling day", "day", day.Format(time.DateOnly))
+		data, err := i.solarWebClient.GetDayChart(ctx, day)
+		if err != nil {
+			return fmt.Errorf("fetching chart of %s: %w", day.Format(time.DateOnly), err)
+		}
+		for _, series := range data.Chart.Series {
+			for _, raw := range series.Data {
+				var sample []float64
+				if err := json.Unmarshal(raw, &sample); err != nil || len(sample) < 2 {
+					continue // not an area spline series
+				}
+				point := influxdb2.NewPointWithMeasurement("power_history").
+					AddTag("series", series.Name).
+					AddField("value", sample[1]).
+					SetTime(time.UnixMilli(int64(sample[0])))
+				i.writePoint(point)
+			}
+		}
+	}
+	return nil
+}
+
 func (i *Importer) RunFastImport() {
 	log.Debug("Running fast import")
-	go i.writePowerData()
+	i.goFetch(i.writePowerData)
 }
 
 func (i *Importer) RunSlowImport() {
 	log.Debug("Running slow import")
-	go i.writeEarningsData()
-	go i.writeBalanceData()
+	i.goFetch(i.writeEarningsData)
+	i.goFetch(i.writeBalanceData)
 }
 
-func (i *Importer) writePowerData() {
-	data, err := i.solarWebClient.GetCompareData()
+func (i *Importer) writePowerData(ctx context.Context) {
+	data, err := i.solarWebClient.GetCompareData(ctx)
 	if err != nil {
 		log.Error("Error fetching power data", "err", err)
 		return
 	}
+	now := time.Now()
+	flow := data.Flow()
 	point := influxdb2.NewPointWithMeasurement("power").
 		AddTag("is_online", strconv.FormatBool(data.IsOnline)).
 		AddTag("all_online", strconv.FormatBool(data.AllOnline)).
+		AddTag("battery_state", data.BatteryModeName).
 		AddField("power_pv", data.PowerPV).
 		AddField("power_grid", data.PowerGrid).
 		AddField("power_load", data.PowerLoad).
 		AddField("power_battery", data.PowerBattery).
+		AddField("power_production", flow.Production).
+		AddField("power_consumption", flow.Consumption).
+		AddField("power_grid_import", flow.GridImport).
+		AddField("power_grid_export", flow.GridExport).
+		AddField("power_battery_charge", flow.BatteryCharge).
+		AddField("power_battery_discharge", flow.BatteryDischarge).
 		AddField("battery_percentage", data.BatteryPercentage).
 		AddField("battery_mode", data.BatteryMode).
-		SetTime(time.Now())
-	logPoint(point)
-	i.influxWriteAPI.WritePoint(point)
+		SetTime(now)
+	i.writePoint(point)
+
+	i.powerMu.Lock()
+	defer i.powerMu.Unlock()
+	for _, observer := range i.observers {
+		for _, derived := range observer.ObservePower(now, data) {
+			i.writePoint(derived)
+		}
+	}
 }
 
-func (i *Importer) writeEarningsData() {
-	data, err := i.solarWebClient.GetProductionsAndEarnings()
+func (i *Importer) writeEarningsData(ctx context.Context) {
+	data, err := i.solarWebClient.GetProductionsAndEarnings(ctx)
 	if err != nil {
 		log.Error("Error fetching production data", "err", err)
 		return
@@ -105,8 +245,7 @@ func (i *Importer) writeEarningsData() {
 		AddField("month", parseLocalizedFloat(data.Data.Earnings.Month)).
 		AddField("day", parseLocalizedFloat(data.Data.Earnings.Today)).
 		SetTime(time.Now())
-	logPoint(earnings)
-	i.influxWriteAPI.WritePoint(earnings)
+	i.writePoint(earnings)
 
 	productions := influxdb2.NewPointWithMeasurement("productions").
 		AddTag("year_name", data.Data.Productions.YearLabel).
@@ -116,12 +255,11 @@ func (i *Importer) writeEarningsData() {
 		AddField("month", parseLocalizedFloat(data.Data.Productions.Month)*getEnergyUnitFactor(data.Data.Productions.MonthUnit)).
 		AddField("today", parseLocalizedFloat(data.Data.Productions.Today)*getEnergyUnitFactor(data.Data.Productions.TodayUnit)).
 		SetTime(time.Now())
-	logPoint(productions)
-	i.influxWriteAPI.WritePoint(productions)
+	i.writePoint(productions)
 }
 
-func (i *Importer) writeBalanceData() {
-	data, err := i.solarWebClient.GetWidgetChart()
+func (i *Importer) writeBalanceData(ctx context.Context) {
+	data, err := i.solarWebClient.GetWidgetChart(ctx)
 	if err != nil {
 		log.Error("Error fetching balance data", "err", err)
 		return
@@ -132,8 +270,7 @@ func (i *Importer) writeBalanceData() {
 		AddField("kwh_to_grid_today", parseLocalizedFloatWithUnit(data.ToGrid)).
 		AddField("kwh_from_grid_today", parseLocalizedFloatWithUnit(data.FromGrid)).
 		SetTime(time.Now())
-	logPoint(balance)
-	i.influxWriteAPI.WritePoint(balance)
+	i.writePoint(balance)
 }
 
 func getEnergyUnitFactor(unit string) float64 {
@@ -174,15 +311,18 @@ func parseLocalizedFloat(value string) float64 {
 	return number
 }
 
-func pointToLineProtocol(point *write.Point) (string, error) {
+// pointToLineProtocol renders the point as one line of line protocol
+// including the trailing newline, with timestamps in the given precision.
+func pointToLineProtocol(point *write.Point, precision time.Duration) (string, error) {
 	var buf bytes.Buffer
 	encoder := lp.NewEncoder(&buf)
+	encoder.SetPrecision(precision)
 	_, err := encoder.Encode(point)
 	return buf.String(), err
 }
 
 func logPoint(point *write.Point) {
-	lineProtocol, err := pointToLineProtocol(point)
+	lineProtocol, err := pointToLineProtocol(point, time.Nanosecond)
 	if err != nil {
 		log.Warn("unable to convert point to line protocol", "err", err)
 	} else {
@@ -0,0 +1,338 @@
+package influx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"solarizer/spool"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/log"
+	influxdb2 "github.com/influxdata/influxdb-client-go/v2"
+	influxdb2api "github.com/influxdata/influxdb-client-go/v2/api"
+	http2 "github.com/influxdata/influxdb-client-go/v2/api/http"
+	"github.com/influxdata/influxdb-client-go/v2/api/write"
+)
+
+const (
+	checkTimeout   = 10 * time.Second
+	replayInterval = time.Minute
+)
+
+type DBConfig struct {
+	Url    string
+	Token  string
+	Org    string
+	Bucket string
+
+	// InfluxDB 1.x target, used instead of Token, Org and Bucket if Database is set
+	Database        string
+	RetentionPolicy string // optional, default retention policy if empty
+	Username        string // optional, no authentication if empty
+	Password        string
+
+	// Retry settings of the write API, zero values keep the client defaults
+	MaxRetries       uint
+	RetryInterval    time.Duration
+	MaxRetryInterval time.Duration
+	MaxRetryTime     time.Duration
+	RetryBufferLimit uint // maximum number of points kept for retries
+
+	// SpoolDir enables spooling of failed writes to disk if set
+	SpoolDir      string
+	SpoolMaxBytes int64
+}
+
+// IsV1 reports whether the config describes an InfluxDB 1.x target.
+func (c DBConfig) IsV1() bool {
+	return c.Database != ""
+}
+
+// authToken returns the token, InfluxDB 1.8 accepts "username:password" in
+// place of a token.
+func (c DBConfig) authToken() string {
+	if !c.IsV1() {
+		return c.Token
+	}
+	if c.Username == "" {
+		return ""
+	}
+	return c.Username + ":" + c.Password
+}
+
+// org returns the organization, which is ignored by InfluxDB 1.8.
+func (c DBConfig) org() string {
+	if c.IsV1() {
+		return ""
+	}
+	return c.Org
+}
+
+// bucket returns the bucket, InfluxDB 1.8 expects "database/retention-policy".
+func (c DBConfig) bucket() string {
+	if !c.IsV1() {
+		return c.Bucket
+	}
+	if c.RetentionPolicy == "" {
+		return c.Database
+	}
+	return c.Database + "/" + c.RetentionPolicy
+}
+
+// NewClient creates a client for the configured target.
+func (c DBConfig) NewClient() influxdb2.Client {
+	return influxdb2.NewClientWithOptions(c.Url, c.authToken(), c.options())
+}
+
+// QueryTarget returns the organization and bucket to send queries to.
+func (c DBConfig) QueryTarget() (org string, bucket string) {
+	return c.org(), c.bucket()
+}
+
+// options converts the config to client options.
+func (c DBConfig) options() *influxdb2.Options {
+	options := influxdb2.DefaultOptions()
+	if c.MaxRetries > 0 {
+		options.SetMaxRetries(c.MaxRetries)
+	}
+	if c.RetryInterval > 0 {
+		options.SetRetryInterval(uint(c.RetryInterval.Milliseconds()))
+	}
+	if c.MaxRetryInterval > 0 {
+		options.SetMaxRetryInterval(uint(c.MaxRetryInterval.Milliseconds()))
+	}
+	if c.MaxRetryTime > 0 {
+		options.SetMaxRetryTime(uint(c.MaxRetryTime.Milliseconds()))
+	}
+	if c.RetryBufferLimit > 0 {
+		options.SetRetryBufferLimit(c.RetryBufferLimit)
+	}
+	return options
+}
+
+// InfluxSink writes points to InfluxDB 2.x or 1.8 using the non-blocking
+// write API of the influx client.
+type InfluxSink struct {
+	SinkState
+	client        influxdb2.Client
+	writeAPI      influxdb2api.WriteAPI
+	writeBlocking influxdb2api.WriteAPIBlocking
+	spool         *spool.Spool // optional
+	stopReplay    context.CancelFunc
+	replayWg      sync.WaitGroup
+}
+
+// NewInfluxSink creates a sink and verifies that the influx database is
+// reachable and the token, organization and bucket are valid.
+func NewInfluxSink(dbConfig DBConfig) (*InfluxSink, error) {
+	client := dbConfig.NewClient()
+
+	ctx, cancel := context.WithTimeout(context.Background(), checkTimeout)
+	defer cancel()
+	if err := checkTarget(ctx, client, dbConfig); err != nil {
+		client.Close()
+		return nil, err
+	}
+
+	var pointSpool *spool.Spool
+	if dbConfig.SpoolDir != "" {
+		var err error
+		pointSpool, err = spool.Open(dbConfig.SpoolDir, dbConfig.SpoolMaxBytes)
+		if err != nil {
+			client.Close()
+			return nil, fmt.Errorf("unable to open spool: %w", err)
+		}
+		log.Info("Spooling failed writes", "dir", dbConfig.SpoolDir, "size", pointSpool.Size())
+	}
+
+	writeAPI := client.WriteAPI(dbConfig.org(), dbConfig.bucket())
+	replayCtx, stopReplay := context.WithCancel(context.Background())
+	s := &InfluxSink{
+		client:        client,
+		writeAPI:      writeAPI,
+		writeBlocking: client.WriteAPIBlocking(dbConfig.org(), dbConfig.bucket()),
+		spool:         pointSpool,
+		stopReplay:    stopReplay,
+	}
+	writeAPI.SetWriteFailedCallback(s.writeFailed)
+	go s.handleWriteErrors(writeAPI.Errors())
+	if pointSpool != nil {
+		s.replayWg.Add(1)
+		go s.runReplayLoop(replayCtx)
+	}
+	return s, nil
+}
+
+func (s *InfluxSink) Name() string {
+	return "influx"
+}
+
+func (s *InfluxSink) WritePoint(point *write.Point) {
+	s.writeAPI.WritePoint(point)
+	s.RecordPoint()
+}
+
+// Status pings the influx database and returns its health.
+func (s *InfluxSink) Status(ctx context.Context) Status {
+	st := s.State(s.Name())
+	if s.spool != nil {
+		st.SpoolBytes = s.spool.Size()
+	}
+
+	ok, err := s.client.Ping(ctx)
+	st.Reachable = ok && err == nil
+	if err != nil {
+		st.PingError = err.Error()
+	}
+	return st
+}
+
+// Close flushes all buffered points and closes the influx client.
+func (s *InfluxSink) Close() {
+	s.stopReplay()
+	s.replayWg.Wait()
+	s.writeAPI.Flush()
+	if s.spool != nil {
+		if err := s.spool.Close(); err != nil {
+			log.Error("Unable to close spool", "err", err)
+		}
+	}
+	s.client.Close()
+}
+
+// handleWriteErrors drains the error channel of the write API until it is
+// closed. Errors must be read, otherwise they are silently dropped.
+func (s *InfluxSink) handleWriteErrors(errs <-chan error) {
+	for err := range errs {
+		log.Error("Error writing to influx", "err", err)
+		s.RecordError(err)
+	}
+}
+
+// writeFailed is called by the write API for every failed batch. The batch
+// is retried unless the error is permanent. If a spool is configured, the
+// batch is spooled to disk instead of being retried from memory.
+func (s *InfluxSink) writeFailed(batch string, err http2.Error, retryAttempts uint) bool {
+	retry := isRetryable(&err)
+	log.Warn("Writing batch to influx failed", "err", err.Error(), "status", err.StatusCode,
+		"attempts", retryAttempts, "retry", retry)
+
+	spooled := false
+	if retry && s.spool != nil {
+		if spoolErr := s.spool.Append([]byte(batch)); spoolErr != nil {
+			log.Error("Unable to spool batch, retrying from memory", "err", spoolErr)
+		} else {
+			spooled = true
+		}
+	}
+
+	s.UpdateStats(func(stats *Stats) {
+		switch {
+		case spooled:
+			stats.Spooled++
+		case retry:
+			stats.Retries++
+		default:
+			stats.Discarded++
+		}
+	})
+	return retry && !spooled
+}
+
+func (s *InfluxSink) runReplayLoop(ctx context.Context) {
+	defer s.replayWg.Done()
+	ticker := time.NewTicker(replayInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.replaySpool(ctx)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// replaySpool writes the spooled batches to influx in the order they failed.
+// Writes are idempotent, so batches replayed twice after a partial failure
+// do no harm.
+func (s *InfluxSink) replaySpool(ctx context.Context) {
+	if s.spool.Size() == 0 {
+		return
+	}
+	log.Info("Replaying spooled batches", "size", s.spool.Size())
+	err := s.spool.Replay(func(batch []byte) error {
+		err := s.writeBlocking.WriteRecord(ctx, string(batch))
+		var httpErr *http2.Error
+		if errors.As(err, &httpErr) && !isRetryable(httpErr) {
+			log.Error("Discarding spooled batch", "err", err)
+			s.UpdateStats(func(stats *Stats) { stats.Discarded++ })
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		s.UpdateStats(func(stats *Stats) { stats.Replayed++ })
+		return nil
+	})
+	if err != nil {
+		log.Warn("Replaying spooled batches failed, retrying later", "err", err)
+	}
+}
+
+// isRetryable reports whether a failed write may succeed later. Client errors
+// like an invalid token or a missing bucket will not.
+func isRetryable(err *http2.Error) bool {
+	switch {
+	case err.StatusCode == 0:
+		return true // network error
+	case err.StatusCode == http.StatusTooManyRequests:
+		return true
+	case err.StatusCode >= 400 && err.StatusCode < 500:
+		return false
+	default:
+		return true
+	}
+}
+
+// checkTarget verifies that the database is reachable and the token is valid
+// for the configured organization and bucket. Tokens that are only allowed to
+// write cannot read buckets, in that case only a warning is logged. InfluxDB
+// 1.x has neither buckets nor organizations, so only reachability is checked.
+func checkTarget(ctx context.Context, client influxdb2.Client, dbConfig DBConfig) error {
+	if _, err := client.Ping(ctx); err != nil {
+		return fmt.Errorf("influx database %s not reachable: %w", dbConfig.Url, err)
+	}
+	if dbConfig.IsV1() {
+		return nil
+	}
+
+	bucket, err := client.BucketsAPI().FindBucketByName(ctx, dbConfig.Bucket)
+	if isForbidden(err) {
+		log.Warn("Token is not allowed to read buckets, skipping bucket check", "bucket", dbConfig.Bucket)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("invalid influx bucket %q: %w", dbConfig.Bucket, err)
+	}
+
+	org, err := client.OrganizationsAPI().FindOrganizationByName(ctx, dbConfig.Org)
+	if isForbidden(err) {
+		log.Warn("Token is not allowed to read organizations, skipping organization check", "org", dbConfig.Org)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("invalid influx organization %q: %w", dbConfig.Org, err)
+	}
+	if bucket.OrgID == nil || org.Id == nil || *bucket.OrgID != *org.Id {
+		return fmt.Errorf("influx bucket %q does not belong to organization %q", dbConfig.Bucket, dbConfig.Org)
+	}
+	return nil
+}
+
+func isForbidden(err error) bool {
+	var httpErr *http2.Error
+	return errors.As(err, &httpErr) && httpErr.StatusCode == http.StatusForbidden
+}
@@ -0,0 +1,262 @@
+package influx
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/influxdata/influxdb-client-go/v2/api/write"
+)
+
+const (
+	lineProtocolFlushInterval = time.Second
+	lineProtocolTimeout       = 10 * time.Second
+	lineProtocolBatchSize     = 5000
+	lineProtocolMaxBuffer     = 50000
+	lineProtocolDrainTimeout  = 3 * time.Second // within the shutdown timeout of serve
+)
+
+// LineProtocolConfig describes an HTTP endpoint accepting line protocol, like
+// InfluxDB 3 (/api/v3/write_lp?db=...), VictoriaMetrics (/write) or
+// QuestDB (/write).
+type LineProtocolConfig struct {
+	Url       string            // complete write URL including path and query
+	Headers   map[string]string // additional headers, e.g. Authorization
+	Precision time.Duration     // precision of the timestamps, nanoseconds if zero, sent as parameter precision
+	Gzip      bool              // compress the request body
+}
+
+// LineProtocolSink posts batches of points rendered as line protocol to an
+// HTTP endpoint. Failed batches are kept in memory and retried with the next
+// flush unless the endpoint rejects them.
+type LineProtocolSink struct {
+	SinkState
+	config LineProtocolConfig
+	client *http.Client
+
+	mu        sync.Mutex
+	lines     []string
+	reachable bool
+
+	flush chan struct{}
+	stop  chan struct{}
+	done  chan struct{}
+}
+
+func NewLineProtocolSink(config LineProtocolConfig) *LineProtocolSink {
+	if config.Precision == 0 {
+		config.Precision = time.Nanosecond
+	}
+	config.Url = withPrecision(config.Url, config.Precision)
+	s := &LineProtocolSink{
+		config:    config,
+		client:    &http.Client{Timeout: lineProtocolTimeout},
+		reachable: true,
+		flush:     make(chan struct{}, 1),
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+	go s.runFlushLoop()
+	return s
+}
+
+func (s *LineProtocolSink) Name() string {
+	return "lineprotocol"
+}
+
+func (s *LineProtocolSink) WritePoint(point *write.Point) {
+	line, err := pointToLineProtocol(point, s.config.Precision)
+	if err != nil {
+		log.Warn("Unable to convert point to line protocol", "err", err)
+		return
+	}
+
+	s.mu.Lock()
+	s.lines = append(s.lines, line)
+	if dropped := len(s.lines) - lineProtocolMaxBuffer; dropped > 0 {
+		s.lines = s.lines[dropped:]
+		s.UpdateStats(func(stats *Stats) { stats.Discarded += uint64(dropped) })
+	}
+	full := len(s.lines) >= lineProtocolBatchSize
+	s.mu.Unlock()
+	s.RecordPoint()
+
+	if full {
+		select {
+		case s.flush <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Status returns whether the last post succeeded. There is no generic way to
+// ping line protocol endpoints.
+func (s *LineProtocolSink) Status(_ context.Context) Status {
+	st := s.State(s.Name())
+	s.mu.Lock()
+	st.Reachable = s.reachable
+	s.mu.Unlock()
+	return st
+}
+
+// Close posts the buffered points and stops the flush loop. Points that cannot
+// be posted within lineProtocolDrainTimeout are discarded.
+func (s *LineProtocolSink) Close() {
+	close(s.stop)
+	<-s.done
+}
+
+func (s *LineProtocolSink) runFlushLoop() {
+	defer close(s.done)
+	ticker := time.NewTicker(lineProtocolFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.flushLines(context.Background())
+		case <-s.flush:
+			s.flushLines(context.Background())
+		case <-s.stop:
+			s.drain()
+			return
+		}
+	}
+}
+
+// drain posts the buffered lines until a post fails or the drain timeout
+// expires, the remaining lines are discarded.
+func (s *LineProtocolSink) drain() {
+	ctx, cancel := context.WithTimeout(context.Background(), lineProtocolDrainTimeout)
+	defer cancel()
+	for s.flushLines(ctx) {
+	}
+
+	s.mu.Lock()
+	n := len(s.lines)
+	s.lines = nil
+	s.mu.Unlock()
+	if n > 0 {
+		log.Warn("Discarding line protocol points on shutdown", "url", s.config.Url, "points", n)
+		s.UpdateStats(func(stats *Stats) { stats.Discarded += uint64(n) })
+	}
+}
+
+// flushLines posts up to one batch of buffered lines. It reports whether a
+// batch was posted successfully.
+func (s *LineProtocolSink) flushLines(ctx context.Context) bool {
+	s.mu.Lock()
+	n := min(len(s.lines), lineProtocolBatchSize)
+	batch := s.lines[:n:n]
+	s.lines = s.lines[n:]
+	s.mu.Unlock()
+	if n == 0 {
+		return false
+	}
+
+	retry, err := s.post(ctx, strings.Join(batch, ""))
+	s.mu.Lock()
+	s.reachable = err == nil || !retry
+	var dropped int
+	if err != nil && retry {
+		// Keep the batch in front of the lines written in the meantime
+		s.lines = append(batch, s.lines...)
+		if dropped = len(s.lines) - lineProtocolMaxBuffer; dropped > 0 {
+			s.lines = s.lines[dropped:]
+		}
+	}
+	s.mu.Unlock()
+
+	if err == nil {
+		return true
+	}
+	log.Error("Error writing line protocol", "url", s.config.Url, "err", err, "retry", retry)
+	s.RecordError(err)
+	s.UpdateStats(func(stats *Stats) {
+		if retry {
+			stats.Retries++
+			stats.Discarded += uint64(max(dropped, 0))
+		} else {
+			stats.Discarded += uint64(n)
+		}
+	})
+	return false
+}
+
+// post sends the body and reports whether a failure may succeed later.
+func (s *LineProtocolSink) post(ctx context.Context, body string) (bool, error) {
+	var reader io.Reader = strings.NewReader(body)
+	if s.config.Gzip {
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		if _, err := gz.Write([]byte(body)); err != nil {
+			return false, err
+		}
+		if err := gz.Close(); err != nil {
+			return false, err
+		}
+		reader = &buf
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.config.Url, reader)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if s.config.Gzip {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	for name, value := range s.config.Headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	message, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	err = fmt.Errorf("received non successful status code %s: %s", resp.Status, strings.TrimSpace(string(message)))
+	retry := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+	return retry, err
+}
+
+// withPrecision adds the precision parameter to the write URL unless it is
+// already given. InfluxDB 3 expects the unit spelled out, InfluxDB 1.x,
+// VictoriaMetrics and QuestDB the abbreviation.
+func withPrecision(rawURL string, precision time.Duration) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL // reported by the first post
+	}
+	query := u.Query()
+	if query.Has("precision") {
+		return rawURL
+	}
+	short, long := "ns", "nanosecond"
+	switch precision {
+	case time.Microsecond:
+		short, long = "us", "microsecond"
+	case time.Millisecond:
+		short, long = "ms", "millisecond"
+	case time.Second:
+		short, long = "s", "second"
+	}
+	if strings.HasPrefix(u.Path, "/api/v3/") {
+		query.Set("precision", long)
+	} else {
+		query.Set("precision", short)
+	}
+	u.RawQuery = query.Encode()
+	return u.String()
+}
@@ -0,0 +1,159 @@
+package influx
+
+import (
+	"compress/gzip"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	influxdb2 "github.com/influxdata/influxdb-client-go/v2"
+)
+
+func TestLineProtocolSinkPostsBatch(t *testing.T) {
+	var body, precision string
+	var header http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header
+		precision = r.URL.Query().Get("precision")
+		reader, err := gzip.NewReader(r.Body)
+		if err != nil {
+			t.Errorf("request body is not gzipped: %v", err)
+			return
+		}
+		bytes, _ := io.ReadAll(reader)
+		body = string(bytes)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	sink := NewLineProtocolSink(LineProtocolConfig{
+		Url:       server.URL + "/api/v3/write_lp?db=solar",
+		Headers:   map[string]string{"Authorization": "Bearer token"},
+		Precision: time.Second,
+		Gzip:      true,
+	})
+	sink.WritePoint(influxdb2.NewPointWithMeasurement("power").
+		AddTag("is_online", "true").
+		AddField("power_pv", 1200.0).
+		SetTime(time.Unix(1700000000, 123)))
+	sink.Close()
+
+	if want := "power,is_online=true power_pv=1200 1700000000\n"; body != want {
+		t.Fatalf("body = %q, want %q", body, want)
+	}
+	if precision != "second" {
+		t.Fatalf("precision = %q, want %q", precision, "second")
+	}
+	if got := header.Get("Authorization"); got != "Bearer token" {
+		t.Fatalf("Authorization = %q, want %q", got, "Bearer token")
+	}
+	if got := sink.Stats().Points; got != 1 {
+		t.Fatalf("Stats().Points = %d, want 1", got)
+	}
+}
+
+func TestLineProtocolSinkDiscardsRejectedBatch(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "invalid line", http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	sink := NewLineProtocolSink(LineProtocolConfig{Url: server.URL + "/write"})
+	sink.WritePoint(influxdb2.NewPointWithMeasurement("power").AddField("power_pv", 1.0))
+	sink.Close()
+
+	stats := sink.Stats()
+	if stats.WriteErrors != 1 || stats.Discarded != 1 {
+		t.Fatalf("Stats() = %+v, want one error and one discarded point", stats)
+	}
+}
+
+func TestLineProtocolSinkBoundsRetriedBatch(t *testing.T) {
+	var sink *LineProtocolSink
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The buffer fills up while the batch is posted
+		sink.mu.Lock()
+		for len(sink.lines) < lineProtocolMaxBuffer {
+			sink.lines = append(sink.lines, "power power_pv=2\n")
+		}
+		sink.mu.Unlock()
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	sink = &LineProtocolSink{config: LineProtocolConfig{Url: server.URL + "/write"}, client: server.Client()}
+	for range lineProtocolBatchSize {
+		sink.lines = append(sink.lines, "power power_pv=1\n")
+	}
+	if sink.flushLines(context.Background()) {
+		t.Fatal("flushLines reported success")
+	}
+	if len(sink.lines) != lineProtocolMaxBuffer || sink.lines[0] != "power power_pv=2\n" {
+		t.Fatalf("%d lines buffered, want %d without the oldest", len(sink.lines), lineProtocolMaxBuffer)
+	}
+	if stats := sink.Stats(); stats.Retries != 1 || stats.Discarded != lineProtocolBatchSize {
+		t.Fatalf("Stats() = %+v, want one retry and the batch discarded", stats)
+	}
+}
+
+func TestLineProtocolSinkDiscardsUnpostedLinesOnClose(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	sink := NewLineProtocolSink(LineProtocolConfig{Url: server.URL + "/write"})
+	for range lineProtocolBatchSize + 10 {
+		sink.WritePoint(influxdb2.NewPointWithMeasurement("power").AddField("power_pv", 1.0))
+	}
+	sink.Close()
+
+	// The drain stops at the first failed post
+	if stats := sink.Stats(); stats.Discarded != lineProtocolBatchSize+10 {
+		t.Fatalf("Stats() = %+v, want all points discarded", stats)
+	}
+}
+
+func TestLineProtocolSinkPostIsCancelled(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	sink := &LineProtocolSink{config: LineProtocolConfig{Url: server.URL + "/write"}, client: server.Client()}
+	sink.lines = []string{"power power_pv=1\n"}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if sink.flushLines(ctx) {
+		t.Fatal("flushLines reported success")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("flushLines returned after %s, want the deadline respected", elapsed)
+	}
+}
+
+func TestWithPrecision(t *testing.T) {
+	for _, tt := range []struct {
+		url       string
+		precision time.Duration
+		want      string
+	}{
+		{"http://vm:8428/write", time.Second, "http://vm:8428/write?precision=s"},
+		{"http://questdb:9000/write", time.Nanosecond, "http://questdb:9000/write?precision=ns"},
+		{"http://influxdb3:8181/api/v3/write_lp?db=solar", time.Millisecond, "http://influxdb3:8181/api/v3/write_lp?db=solar&precision=millisecond"},
+		{"http://vm:8428/write?precision=ms", time.Second, "http://vm:8428/write?precision=ms"},
+	} {
+		if got := withPrecision(tt.url, tt.precision); got != tt.want {
+			t.Errorf("withPrecision(%q, %s) = %q, want %q", tt.url, tt.precision, got, tt.want)
+		}
+	}
+}
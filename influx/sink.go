@@ -0,0 +1,107 @@
+package influx
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/influxdata/influxdb-client-go/v2/api/write"
+)
+
+// errorWindow is the time a write error keeps a sink unhealthy
+const errorWindow = time.Minute
+
+// Sink is a destination for the points written by the importer.
+type Sink interface {
+	// Name identifies the sink in logs, metrics and the readiness endpoint
+	Name() string
+	// WritePoint queues the point for writing, it must not block
+	WritePoint(point *write.Point)
+	// Status returns the health of the sink, it may contact the database
+	Status(ctx context.Context) Status
+	// Stats returns the write counters without contacting the database
+	Stats() Stats
+	// Close writes all queued points and releases all resources
+	Close()
+}
+
+// Status describes the health of a sink.
+type Status struct {
+	Name          string    `json:"name"`
+	Reachable     bool      `json:"reachable"`
+	PingError     string    `json:"ping_error,omitempty"`
+	LastWrite     time.Time `json:"last_write"`
+	LastError     string    `json:"last_error,omitempty"`
+	LastErrorTime time.Time `json:"last_error_time"`
+	SpoolBytes    int64     `json:"spool_bytes,omitempty"`
+	Stats         Stats     `json:"stats"`
+}
+
+// Stats counts the points written to a sink and the failures.
+type Stats struct {
+	Points      uint64 `json:"points"`
+	WriteErrors uint64 `json:"write_errors"`
+	Retries     uint64 `json:"retries"`
+	Discarded   uint64 `json:"discarded"`
+	Spooled     uint64 `json:"spooled"`
+	Replayed    uint64 `json:"replayed"`
+}
+
+// Healthy reports whether the sink is reachable and no write failed recently.
+func (st Status) Healthy() bool {
+	return st.Reachable && time.Since(st.LastErrorTime) > errorWindow
+}
+
+// SinkState tracks the writes and errors of a sink. It is safe for
+// concurrent use and meant to be embedded by Sink implementations.
+type SinkState struct {
+	mu            sync.Mutex
+	lastWrite     time.Time
+	lastError     string
+	lastErrorTime time.Time
+	stats         Stats
+}
+
+// RecordPoint counts a point queued for writing.
+func (s *SinkState) RecordPoint() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastWrite = time.Now()
+	s.stats.Points++
+}
+
+// RecordError remembers a failed write.
+func (s *SinkState) RecordError(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastError = err.Error()
+	s.lastErrorTime = time.Now()
+	s.stats.WriteErrors++
+}
+
+// UpdateStats modifies the counters under the lock.
+func (s *SinkState) UpdateStats(update func(stats *Stats)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	update(&s.stats)
+}
+
+// Stats returns the write counters.
+func (s *SinkState) Stats() Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stats
+}
+
+// State returns the recorded writes and errors as status of the named sink.
+func (s *SinkState) State(name string) Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return Status{
+		Name:          name,
+		LastWrite:     s.lastWrite,
+		LastError:     s.lastError,
+		LastErrorTime: s.lastErrorTime,
+		Stats:         s.stats,
+	}
+}
@@ -0,0 +1,100 @@
+package kpi
+
+import (
+	"solarizer/energy"
+	"solarizer/solarweb"
+	"time"
+
+	influxdb2 "github.com/influxdata/influxdb-client-go/v2"
+	"github.com/influxdata/influxdb-client-go/v2/api/write"
+)
+
+// KPIs are the flows and the rates derived from them. Rates are between 0
+// and 1, and 0 if there was no PV production or load respectively.
+type KPIs struct {
+	energy.Flows
+	SelfConsumptionRate float64 `json:"self_consumption_rate"` // share of PV consumed on site
+	Autarky             float64 `json:"autarky"`               // share of the load not supplied by the grid, also known as self-sufficiency
+}
+
+// Compute derives the rates of the flows, which may be powers or energies.
+func Compute(f energy.Flows) KPIs {
+	k := KPIs{Flows: f}
+	if f.PV > 0 {
+		k.SelfConsumptionRate = min(f.SelfConsumption/f.PV, 1)
+	}
+	if f.Load > 0 {
+		k.Autarky = min(max(1-f.GridImport/f.Load, 0), 1)
+	}
+	return k
+}
+
+// Period holds the KPIs of the energy since Start.
+type Period struct {
+	Start time.Time `json:"start"`
+	KPIs
+}
+
+// Snapshot holds the KPIs of the last sample and of the current day and
+// month.
+type Snapshot struct {
+	Time    time.Time `json:"time"`
+	Instant KPIs      `json:"instant"`
+	Day     Period    `json:"day"`
+	Month   Period    `json:"month"`
+}
+
+// Tracker computes the KPIs of every power sample and of the energy counters
+// of the current day and month. It implements influx.PowerObserver.
+type Tracker struct {
+	integrator *energy.Integrator
+}
+
+func NewTracker(integrator *energy.Integrator) *Tracker {
+	return &Tracker{integrator: integrator}
+}
+
+// ObservePower returns the measurements "kpi" (W), "kpi_day" and "kpi_month"
+// (Wh).
+func (t *Tracker) ObservePower(now time.Time, _ solarweb.CompareData) []*write.Point {
+	counters, ok := t.integrator.CountersAt(now)
+	if !ok {
+		return nil
+	}
+	snapshot := newSnapshot(counters)
+	return []*write.Point{
+		newPoint("kpi", now, snapshot.Instant),
+		newPoint("kpi_day", now, snapshot.Day.KPIs),
+		newPoint("kpi_month", now, snapshot.Month.KPIs),
+	}
+}
+
+// Snapshot returns the current KPIs.
+func (t *Tracker) Snapshot() Snapshot {
+	return newSnapshot(t.integrator.Counters())
+}
+
+func newSnapshot(counters energy.Counters) Snapshot {
+	return Snapshot{
+		Time:    counters.Time,
+		Instant: Compute(counters.Power),
+		Day:     Period{Start: counters.DayStart, KPIs: Compute(counters.Day)},
+		Month:   Period{Start: counters.MonthStart, KPIs: Compute(counters.Month)},
+	}
+}
+
+func newPoint(measurement string, t time.Time, k KPIs) *write.Point {
+	return influxdb2.NewPointWithMeasurement(measurement).
+		AddField("pv", k.PV).
+		AddField("load", k.Load).
+		AddField("grid_import", k.GridImport).
+		AddField("grid_export", k.GridExport).
+		AddField("battery_charge", k.BatteryCharge).
+		AddField("battery_discharge", k.BatteryDischarge).
+		AddField("self_consumption", k.SelfConsumption).
+		AddField("direct_consumption", k.DirectConsumption).
+		AddField("battery_contribution", k.BatteryContribution).
+		AddField("self_consumption_rate", k.SelfConsumptionRate).
+		AddField("autarky", k.Autarky).
+		SetTime(t)
+}
@@ -0,0 +1,43 @@
+package kpi
+
+import (
+	"math"
+	"solarizer/energy"
+	"solarizer/solarweb"
+	"testing"
+	"time"
+)
+
+func TestCompute(t *testing.T) {
+	k := Compute(energy.FromSample(solarweb.CompareData{PowerPV: 3000, PowerBattery: -1000, PowerGrid: -500, PowerLoad: -1500}))
+	if math.Abs(k.SelfConsumptionRate-2500.0/3000) > 1e-9 || k.Autarky != 1 {
+		t.Fatalf("rates = %v, %v, want 0.83 and 1", k.SelfConsumptionRate, k.Autarky)
+	}
+
+	k = Compute(energy.FromSample(solarweb.CompareData{PowerBattery: 300, PowerGrid: 100, PowerLoad: -400}))
+	if k.SelfConsumptionRate != 0 || k.Autarky != 0.75 {
+		t.Fatalf("rates = %v, %v, want 0 and 0.75", k.SelfConsumptionRate, k.Autarky)
+	}
+}
+
+func TestTrackerUsesDailyEnergy(t *testing.T) {
+	integrator, _ := energy.Open("")
+	tracker := NewTracker(integrator)
+	start := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	for i, grid := range []float64{1000, 0} {
+		now := start.Add(time.Duration(i) * time.Minute)
+		data := solarweb.CompareData{PowerPV: 1000 - grid, PowerGrid: grid, PowerLoad: -1000}
+		integrator.ObservePower(now, data)
+		if points := tracker.ObservePower(now, data); len(points) != 3 {
+			t.Fatalf("ObservePower returned %d points, want 3", len(points))
+		}
+	}
+
+	snapshot := tracker.Snapshot()
+	if snapshot.Instant.Autarky != 1 {
+		t.Fatalf("instant autarky = %v, want 1", snapshot.Instant.Autarky)
+	}
+	if snapshot.Day.Autarky != 0.5 || snapshot.Month.Autarky != 0.5 {
+		t.Fatalf("day autarky = %v, month autarky = %v, want 0.5", snapshot.Day.Autarky, snapshot.Month.Autarky)
+	}
+}
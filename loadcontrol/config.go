@@ -0,0 +1,97 @@
+package loadcontrol
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"solarizer/mqtt"
+	"time"
+)
+
+type configFile struct {
+	MQTT struct {
+		Broker   string `json:"broker"`
+		Username string `json:"username"`
+		Password string `json:"password"`
+		ClientID string `json:"client_id"`
+	} `json:"mqtt"`
+	Loads []struct {
+		Name       string  `json:"name"`
+		OnAbove    float64 `json:"on_above"`
+		OffBelow   float64 `json:"off_below"`
+		MinOn      string  `json:"min_on"`
+		MinOff     string  `json:"min_off"`
+		OnURL      string  `json:"on_url"`
+		OffURL     string  `json:"off_url"`
+		MQTTTopic  string  `json:"mqtt_topic"`
+		OnPayload  string  `json:"on_payload"`
+		OffPayload string  `json:"off_payload"`
+	} `json:"loads"`
+}
+
+// LoadConfig reads the loads from a JSON file, see README.md.
+func LoadConfig(filename string) ([]Load, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var config configFile
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("invalid load control config %s: %w", filename, err)
+	}
+
+	mqttConfig := mqtt.Config{
+		Broker:   config.MQTT.Broker,
+		Username: config.MQTT.Username,
+		Password: config.MQTT.Password,
+		ClientID: config.MQTT.ClientID,
+	}
+	if mqttConfig.ClientID == "" {
+		mqttConfig.ClientID = "solarizer"
+	}
+	clientID := mqttConfig.ClientID
+	loads := make([]Load, 0, len(config.Loads))
+	names := make(map[string]bool)
+	for i, item := range config.Loads {
+		load := Load{Name: item.Name, OnAbove: item.OnAbove, OffBelow: item.OffBelow}
+		if load.Name == "" {
+			return nil, fmt.Errorf("load %d: missing name", i+1)
+		}
+		if names[load.Name] {
+			return nil, fmt.Errorf("load %s: duplicate name", load.Name)
+		}
+		names[load.Name] = true
+		if load.OffBelow >= load.OnAbove {
+			return nil, fmt.Errorf("load %s: off_below must be lower than on_above", load.Name)
+		}
+		if load.MinOn, err = parseDuration(item.MinOn); err != nil {
+			return nil, fmt.Errorf("load %s: invalid min_on: %w", load.Name, err)
+		}
+		if load.MinOff, err = parseDuration(item.MinOff); err != nil {
+			return nil, fmt.Errorf("load %s: invalid min_off: %w", load.Name, err)
+		}
+		switch {
+		case item.OnURL != "" && item.OffURL != "":
+			load.Switch = NewHTTPSwitch(item.OnURL, item.OffURL)
+		case item.MQTTTopic != "" && mqttConfig.Broker != "":
+			onPayload, offPayload := item.OnPayload, item.OffPayload
+			if onPayload == "" && offPayload == "" {
+				onPayload, offPayload = "ON", "OFF"
+			}
+			// The loads are switched concurrently, each needs its own client ID
+			mqttConfig.ClientID = clientID + "-" + load.Name
+			load.Switch = NewMQTTSwitch(mqttConfig, item.MQTTTopic, onPayload, offPayload)
+		default:
+			return nil, fmt.Errorf("load %s: expected on_url and off_url, or mqtt_topic and an MQTT broker", load.Name)
+		}
+		loads = append(loads, load)
+	}
+	return loads, nil
+}
+
+func parseDuration(value string) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+	return time.ParseDuration(value)
+}
@@ -0,0 +1,302 @@
+package loadcontrol
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"solarizer/solarweb"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/log"
+	influxdb2 "github.com/influxdata/influxdb-client-go/v2"
+	"github.com/influxdata/influxdb-client-go/v2/api/write"
+)
+
+const (
+	switchTimeout = 10 * time.Second
+	// maxDecisions is the number of switching decisions kept in the log
+	maxDecisions = 200
+	// queueSize is the number of pending switch calls per load
+	queueSize = 8
+	// checkInterval is the interval missing samples are checked in
+	checkInterval = time.Minute
+)
+
+// Load is an external load switched by the surplus.
+type Load struct {
+	Name     string
+	OnAbove  float64       // surplus in W the load is switched on above
+	OffBelow float64       // surplus in W the load is switched off below, lower than OnAbove
+	MinOn    time.Duration // minimum time the load stays on
+	MinOff   time.Duration // minimum time the load stays off
+	Switch   Switch
+}
+
+// LoadState is the state of a load.
+type LoadState struct {
+	Name     string    `json:"name"`
+	On       *bool     `json:"on"` // nil until the first decision
+	Since    time.Time `json:"since"`
+	OnAbove  float64   `json:"on_above"`
+	OffBelow float64   `json:"off_below"`
+}
+
+// Decision is a logged switching decision.
+type Decision struct {
+	Time    time.Time `json:"time"`
+	Load    string    `json:"load"`
+	On      bool      `json:"on"`
+	Surplus float64   `json:"surplus"`
+	Reason  string    `json:"reason"`
+	DryRun  bool      `json:"dry_run"`
+	Error   string    `json:"error,omitempty"`
+}
+
+// Surplus returns the PV power available for additional loads: the grid
+// export plus the power charging the battery, minus the power discharging it.
+// Loads are thus switched on before the battery is charged and not powered by
+// the battery.
+func Surplus(data solarweb.CompareData) float64 {
+	flow := data.Flow()
+	return -flow.GridPower() - flow.BatteryPower()
+}
+
+// Controller switches the loads by the surplus of every sample. At most one
+// load is switched on per sample, in the order of the loads, so the next
+// sample reflects its consumption. While the system is offline or its data is
+// frozen or stale, loads are not switched on and are switched off after their
+// minimum on time. It implements influx.PowerObserver.
+type Controller struct {
+	loads      []Load
+	dryRun     bool // decisions are logged, but the loads are not switched
+	staleAfter time.Duration
+
+	mu         sync.Mutex
+	states     []LoadState
+	decisions  []Decision
+	last       time.Time          // time of the last sample
+	lastFlow   solarweb.PowerFlow // flow of the last sample
+	lastChange time.Time          // last sample with a different flow
+	closed     bool
+
+	queues   []chan Decision // switch calls per load, executed in order
+	switchWg sync.WaitGroup
+}
+
+// NewController creates a controller. The state of the loads is unknown until
+// the first sample, which switches every load on or off. Data without changes
+// or samples for staleAfter is not acted on. Close stops the switching.
+func NewController(loads []Load, dryRun bool, staleAfter time.Duration) *Controller {
+	c := &Controller{
+		loads:      loads,
+		dryRun:     dryRun,
+		staleAfter: staleAfter,
+		states:     make([]LoadState, len(loads)),
+		queues:     make([]chan Decision, len(loads)),
+	}
+	for i, load := range loads {
+		c.states[i] = LoadState{Name: load.Name, OnAbove: load.OnAbove, OffBelow: load.OffBelow}
+		c.queues[i] = make(chan Decision, queueSize)
+		c.switchWg.Add(1)
+		go c.runSwitch(load, c.queues[i])
+	}
+	return c
+}
+
+// ObservePower decides on the loads and returns the measurement
+// "load_control" per load.
+func (c *Controller) ObservePower(now time.Time, data solarweb.CompareData) []*write.Point {
+	surplus := Surplus(data)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !now.After(c.last) {
+		return nil
+	}
+	if flow := data.Flow(); c.lastChange.IsZero() || flow != c.lastFlow {
+		c.lastChange = now
+		c.lastFlow = flow
+	}
+	c.last = now
+
+	unreliable := ""
+	switch {
+	case !data.IsOnline:
+		unreliable = "system offline"
+	case now.Sub(c.lastChange) >= c.staleAfter:
+		unreliable = fmt.Sprintf("data frozen since %s", c.lastChange.Format(time.TimeOnly))
+	}
+	switchedOn := false
+	points := make([]*write.Point, 0, len(c.loads))
+	for i, load := range c.loads {
+		st := &c.states[i]
+		var on *bool
+		var reason string
+		if unreliable != "" {
+			on, reason = c.switchOff(now, load, st, unreliable)
+		} else {
+			on, reason = c.decide(now, load, st, surplus, switchedOn)
+		}
+		if on != nil {
+			switchedOn = switchedOn || *on
+			st.On, st.Since = on, now
+			c.switchLoad(i, Decision{Time: now, Load: load.Name, On: *on, Surplus: surplus, Reason: reason, DryRun: c.dryRun})
+		}
+		if st.On != nil {
+			points = append(points, influxdb2.NewPointWithMeasurement("load_control").
+				AddTag("load", load.Name).
+				AddField("on", *st.On).
+				AddField("surplus", surplus).
+				SetTime(now))
+		}
+	}
+	return points
+}
+
+// decide returns the new state of the load and the reason, or nil to keep the
+// state.
+func (c *Controller) decide(now time.Time, load Load, st *LoadState, surplus float64, switchedOn bool) (*bool, string) {
+	on, off := true, false
+	switch {
+	case st.On == nil && surplus > load.OnAbove && !switchedOn:
+		return &on, fmt.Sprintf("initial state, surplus %.0f W above %.0f W", surplus, load.OnAbove)
+	case st.On == nil && surplus <= load.OnAbove:
+		return &off, fmt.Sprintf("initial state, surplus %.0f W not above %.0f W", surplus, load.OnAbove)
+	case st.On == nil:
+		return nil, ""
+	case *st.On && surplus < load.OffBelow && now.Sub(st.Since) >= load.MinOn:
+		return &off, fmt.Sprintf("surplus %.0f W below %.0f W", surplus, load.OffBelow)
+	case !*st.On && surplus > load.OnAbove && now.Sub(st.Since) >= load.MinOff && !switchedOn:
+		return &on, fmt.Sprintf("surplus %.0f W above %.0f W", surplus, load.OnAbove)
+	default:
+		return nil, ""
+	}
+}
+
+// Run switches off the loads if no sample arrives for the stale duration,
+// until ctx is cancelled.
+func (c *Controller) Run(ctx context.Context) {
+	ticker := time.NewTicker(checkInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			c.checkStale(now)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// checkStale switches off the loads if the last sample is older than the
+// stale duration.
+func (c *Controller) checkStale(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.last.IsZero() || now.Sub(c.last) <= c.staleAfter {
+		return
+	}
+	reason := fmt.Sprintf("no sample since %s", c.last.Format(time.TimeOnly))
+	for i, load := range c.loads {
+		st := &c.states[i]
+		if on, reason := c.switchOff(now, load, st, reason); on != nil {
+			st.On, st.Since = on, now
+			c.switchLoad(i, Decision{Time: now, Load: load.Name, On: false, Reason: reason, DryRun: c.dryRun})
+		}
+	}
+}
+
+// switchOff returns the off state if the load is on for its minimum time or
+// its state is unknown, or nil to keep the state.
+func (c *Controller) switchOff(now time.Time, load Load, st *LoadState, reason string) (*bool, string) {
+	off := false
+	switch {
+	case st.On == nil:
+		return &off, "initial state, " + reason
+	case *st.On && now.Sub(st.Since) >= load.MinOn:
+		return &off, reason
+	default:
+		return nil, ""
+	}
+}
+
+// switchLoad logs the decision and queues the switch call, so slow devices do
+// not delay the import. The caller holds mu.
+func (c *Controller) switchLoad(index int, decision Decision) {
+	log.Info("Switching load", "load", decision.Load, "on", decision.On, "reason", decision.Reason, "dry_run", decision.DryRun)
+	c.decisions = append(c.decisions, decision)
+	if len(c.decisions) > maxDecisions {
+		c.decisions = slices.Clone(c.decisions[len(c.decisions)-maxDecisions:])
+	}
+	if c.dryRun || c.closed || c.loads[index].Switch == nil {
+		return
+	}
+	select {
+	case c.queues[index] <- decision:
+	default:
+		log.Error("Dropped switching of load, too many pending calls", "load", decision.Load, "on", decision.On)
+		c.setError(decision, "dropped, too many pending calls")
+	}
+}
+
+// runSwitch executes the switch calls of a load until the queue is closed.
+func (c *Controller) runSwitch(load Load, queue <-chan Decision) {
+	defer c.switchWg.Done()
+	for decision := range queue {
+		ctx, cancel := context.WithTimeout(context.Background(), switchTimeout)
+		err := load.Switch.Set(ctx, decision.On)
+		cancel()
+		if err != nil {
+			log.Error("Error switching load", "load", decision.Load, "on", decision.On, "err", err)
+			c.mu.Lock()
+			c.setError(decision, err.Error())
+			c.mu.Unlock()
+		}
+	}
+}
+
+// setError records the error in the logged decision. The caller holds mu.
+func (c *Controller) setError(decision Decision, err string) {
+	i := slices.IndexFunc(c.decisions, func(d Decision) bool {
+		return d.Time.Equal(decision.Time) && d.Load == decision.Load
+	})
+	if i >= 0 {
+		c.decisions[i].Error = err
+	}
+}
+
+// States returns the state of the loads.
+func (c *Controller) States() []LoadState {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return slices.Clone(c.states)
+}
+
+// Decisions returns the logged decisions, newest first.
+func (c *Controller) Decisions() []Decision {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	decisions := slices.Clone(c.decisions)
+	slices.Reverse(decisions)
+	if decisions == nil {
+		decisions = []Decision{}
+	}
+	return decisions
+}
+
+// DryRun reports whether the loads are only switched in the log.
+func (c *Controller) DryRun() bool {
+	return c.dryRun
+}
+
+// Close waits for pending switch calls. No samples may be observed
+// afterwards.
+func (c *Controller) Close() {
+	c.mu.Lock()
+	c.closed = true
+	c.mu.Unlock()
+	for _, queue := range c.queues {
+		close(queue)
+	}
+	c.switchWg.Wait()
+}
@@ -0,0 +1,218 @@
+package loadcontrol
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"solarizer/solarweb"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type recordingSwitch struct {
+	mu    sync.Mutex
+	calls []bool
+}
+
+func (s *recordingSwitch) Set(_ context.Context, on bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls = append(s.calls, on)
+	return nil
+}
+
+// export returns a sample exporting the power to the grid.
+func export(power float64) solarweb.CompareData {
+	return solarweb.CompareData{IsOnline: true, PowerGrid: -power}
+}
+
+func TestHysteresisAndMinimumTimes(t *testing.T) {
+	heater := &recordingSwitch{}
+	controller := NewController([]Load{
+		{Name: "heater", OnAbove: 2000, OffBelow: 0, MinOn: 10 * time.Minute, MinOff: 5 * time.Minute, Switch: heater},
+	}, false, 15*time.Minute)
+
+	start := time.Date(2025, 6, 1, 10, 0, 0, 0, time.UTC)
+	for _, step := range []struct {
+		minute  int
+		surplus float64
+	}{
+		{0, 500},   // initial state off
+		{1, 2500},  // off for less than 5 minutes
+		{5, 2500},  // on
+		{6, -300},  // on for less than 10 minutes
+		{10, 1000}, // within the hysteresis
+		{15, -300}, // off
+		{16, 2500}, // off for less than 5 minutes
+		{20, 2500}, // on
+	} {
+		controller.ObservePower(start.Add(time.Duration(step.minute)*time.Minute), export(step.surplus))
+	}
+	controller.Close()
+
+	if want := []bool{false, true, false, true}; !equal(heater.calls, want) {
+		t.Fatalf("switch calls = %v, want %v", heater.calls, want)
+	}
+	decisions := controller.Decisions()
+	if len(decisions) != 4 || !decisions[0].On || !decisions[0].Time.Equal(start.Add(20*time.Minute)) {
+		t.Fatalf("decisions = %+v, want four newest first", decisions)
+	}
+}
+
+func TestOneLoadSwitchedOnPerSampleAndDryRun(t *testing.T) {
+	first, second := &recordingSwitch{}, &recordingSwitch{}
+	controller := NewController([]Load{
+		{Name: "wallbox", OnAbove: 1000, OffBelow: -500, Switch: first},
+		{Name: "heater", OnAbove: 1000, OffBelow: -500, Switch: second},
+	}, true, 15*time.Minute)
+
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	controller.ObservePower(now, export(5000))
+	states := controller.States()
+	if !*states[0].On || states[1].On != nil {
+		t.Fatalf("states = %+v, want only the first load on", states)
+	}
+	controller.ObservePower(now.Add(15*time.Second), export(3000))
+	if states := controller.States(); !*states[1].On {
+		t.Fatalf("states = %+v, want the second load on with the next sample", states)
+	}
+	controller.Close()
+	if len(first.calls) != 0 || len(second.calls) != 0 {
+		t.Fatal("dry run switched loads")
+	}
+	if decisions := controller.Decisions(); len(decisions) != 2 || !decisions[0].DryRun {
+		t.Fatalf("decisions = %+v, want two dry run decisions", decisions)
+	}
+}
+
+func TestUnreliableDataSwitchesOff(t *testing.T) {
+	heater := &recordingSwitch{}
+	controller := NewController([]Load{
+		{Name: "heater", OnAbove: 2000, OffBelow: 0, MinOn: 10 * time.Minute, Switch: heater},
+	}, false, 15*time.Minute)
+
+	start := time.Date(2025, 6, 1, 10, 0, 0, 0, time.UTC)
+	sample := func(minute int, data solarweb.CompareData) {
+		controller.ObservePower(start.Add(time.Duration(minute)*time.Minute), data)
+	}
+	sample(0, export(3000)) // on
+	offline := export(3000)
+	offline.IsOnline = false
+	sample(5, offline)       // on for less than 10 minutes
+	sample(10, offline)      // off
+	sample(11, offline)      // not switched on
+	sample(12, export(2800)) // on
+	// Identical samples from 10:12 are frozen at 10:27
+	for minute := 13; minute <= 27; minute++ {
+		sample(minute, export(2800))
+	}
+	// No samples after 10:40
+	sample(40, export(3500)) // on
+	controller.checkStale(start.Add(50 * time.Minute))
+	controller.checkStale(start.Add(56 * time.Minute))
+	controller.Close()
+
+	if want := []bool{true, false, true, false, true, false}; !equal(heater.calls, want) {
+		t.Fatalf("switch calls = %v, want %v", heater.calls, want)
+	}
+	decisions := controller.Decisions()
+	for i, want := range []string{"no sample since 10:40:00", "surplus 3500 W above 2000 W", "data frozen since 10:12:00", "surplus 2800 W above 2000 W", "system offline"} {
+		if decisions[i].Reason != want {
+			t.Errorf("decision %d = %+v, want reason %q", i, decisions[i], want)
+		}
+	}
+}
+
+func TestSurplusExcludesBatteryDischarge(t *testing.T) {
+	charging := solarweb.CompareData{PowerGrid: -1000, PowerBattery: -2000}
+	discharging := solarweb.CompareData{PowerGrid: 0, PowerBattery: 1500}
+	if s := Surplus(charging); s != 3000 {
+		t.Errorf("surplus while charging = %.0f W, want 3000 W", s)
+	}
+	if s := Surplus(discharging); s != -1500 {
+		t.Errorf("surplus while discharging = %.0f W, want -1500 W", s)
+	}
+}
+
+func TestLoadConfigWithHTTPSwitch(t *testing.T) {
+	var paths []string
+	var mu sync.Mutex
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		paths = append(paths, r.URL.String())
+	}))
+	defer server.Close()
+
+	filename := filepath.Join(t.TempDir(), "loads.json")
+	config := `{"loads": [{"name": "heater", "on_above": 2000, "off_below": 0, "min_on": "10m",
+		"on_url": "SERVER/relay/0?turn=on", "off_url": "SERVER/relay/0?turn=off"}]}`
+	if err := os.WriteFile(filename, []byte(strings.ReplaceAll(config, "SERVER", server.URL)), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	loads, err := LoadConfig(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(loads) != 1 || loads[0].MinOn != 10*time.Minute {
+		t.Fatalf("loads = %+v", loads)
+	}
+	if err := loads[0].Switch.Set(context.Background(), true); err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) != 1 || paths[0] != "/relay/0?turn=on" {
+		t.Fatalf("requested %v", paths)
+	}
+
+	invalid := `{"loads": [{"name": "heater", "on_above": 0, "off_below": 100, "on_url": "x", "off_url": "y"}]}`
+	if err := os.WriteFile(filename, []byte(invalid), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadConfig(filename); err == nil {
+		t.Fatal("LoadConfig accepted off_below above on_above")
+	}
+}
+
+func TestLoadConfigWithMQTTSwitches(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "loads.json")
+	config := `{"mqtt": {"broker": "tcp://mosquitto:1883"}, "loads": [
+		{"name": "wallbox", "on_above": 1500, "off_below": 0, "mqtt_topic": "cmnd/wallbox/POWER"},
+		{"name": "heater", "on_above": 2000, "off_below": 0, "mqtt_topic": "cmnd/heater/POWER"}]}`
+	if err := os.WriteFile(filename, []byte(config), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	loads, err := LoadConfig(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The switches publish concurrently and must not take over each other's session
+	for i, want := range []string{"solarizer-wallbox", "solarizer-heater"} {
+		if got := loads[i].Switch.(*MQTTSwitch).config.ClientID; got != want {
+			t.Errorf("client ID of %s = %q, want %q", loads[i].Name, got, want)
+		}
+	}
+
+	duplicate := strings.ReplaceAll(config, `"heater"`, `"wallbox"`)
+	if err := os.WriteFile(filename, []byte(duplicate), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadConfig(filename); err == nil {
+		t.Fatal("LoadConfig accepted duplicate names")
+	}
+}
+
+func equal(a []bool, b []bool) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,70 @@
+package loadcontrol
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"solarizer/mqtt"
+	"strings"
+	"time"
+)
+
+// Switch turns an external load on or off.
+type Switch interface {
+	Set(ctx context.Context, on bool) error
+}
+
+// HTTPSwitch calls a URL to switch, e.g.
+// "http://shelly/relay/0?turn=on" or "http://tasmota/cm?cmnd=Power%20On".
+type HTTPSwitch struct {
+	onURL  string
+	offURL string
+	client *http.Client
+}
+
+func NewHTTPSwitch(onURL string, offURL string) *HTTPSwitch {
+	return &HTTPSwitch{onURL: onURL, offURL: offURL, client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+func (s *HTTPSwitch) Set(ctx context.Context, on bool) error {
+	url := s.offURL
+	if on {
+		url = s.onURL
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("unexpected status %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// MQTTSwitch publishes a retained payload to a topic to switch, e.g. "ON" to
+// "cmnd/heater/POWER".
+type MQTTSwitch struct {
+	config     mqtt.Config
+	topic      string
+	onPayload  string
+	offPayload string
+}
+
+func NewMQTTSwitch(config mqtt.Config, topic string, onPayload string, offPayload string) *MQTTSwitch {
+	return &MQTTSwitch{config: config, topic: topic, onPayload: onPayload, offPayload: offPayload}
+}
+
+func (s *MQTTSwitch) Set(ctx context.Context, on bool) error {
+	payload := s.offPayload
+	if on {
+		payload = s.onPayload
+	}
+	return mqtt.Publish(ctx, s.config, s.topic, []byte(payload), true)
+}
@@ -0,0 +1,58 @@
+package mail
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// Config configures the mail server. STARTTLS is used if the server supports
+// it.
+type Config struct {
+	Addr     string // host:port
+	Username string // optional, no authentication if empty
+	Password string
+	From     string
+	To       []string
+}
+
+// Message is a mail with a single part body.
+type Message struct {
+	Subject     string
+	ContentType string // e.g. "text/plain; charset=utf-8"
+	Date        time.Time
+	Body        string
+}
+
+// Send sends the message to all recipients of the config.
+func Send(ctx context.Context, config Config, message Message) error {
+	var auth smtp.Auth
+	if config.Username != "" {
+		host, _, _ := net.SplitHostPort(config.Addr)
+		auth = smtp.PlainAuth("", config.Username, config.Password, host)
+	}
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", config.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(config.To, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", message.Subject)
+	fmt.Fprintf(&msg, "Date: %s\r\n", message.Date.Format(time.RFC1123Z))
+	fmt.Fprintf(&msg, "MIME-Version: 1.0\r\nContent-Type: %s\r\n\r\n", message.ContentType)
+	msg.WriteString(strings.ReplaceAll(message.Body, "\n", "\r\n"))
+
+	// smtp.SendMail does not take a context, the mail is sent in the
+	// background and abandoned if ctx expires
+	done := make(chan error, 1)
+	go func() {
+		done <- smtp.SendMail(config.Addr, auth, config.From, config.To, msg.Bytes())
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
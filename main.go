@@ -1,13 +1,20 @@
 package main
 
 import (
-	"context"
+	"fmt"
 	"os"
-	"os/signal"
-	"solarizer/apiserver"
+	"solarizer/alert"
+	"solarizer/anomaly"
+	"solarizer/forecast"
+	"solarizer/history"
 	"solarizer/influx"
+	"solarizer/mail"
+	"solarizer/postgres"
+	"solarizer/report"
 	"solarizer/solarweb"
-	"syscall"
+	"solarizer/tariff"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/charmbracelet/log"
@@ -17,7 +24,21 @@ const (
 	apiServerAddr = ":8080"
 )
 
-var solarWebClient *solarweb.SolarWeb
+const usage = `Usage: solarizer [command] [arguments]
+
+Commands:
+  serve                                 Run the API server and the Influx importer (default)
+  login                                 Log into SolarWeb and persist the auth cookie
+  fetch power|production|balance        Fetch current data from SolarWeb
+        [--format json|table]
+  cookie set <value>                    Set and persist the auth cookie
+  cookie show                           Print the persisted auth cookie
+  backfill --from <date> --to <date>    Import daily production charts into Influx
+  export --from <date> [--to <date>]    Export the history as CSV or Parquet
+        [--every <duration>] [--format csv|parquet] [--tz <zone>] [--output <file>]
+  healthcheck [--addr <url>] [--live]   Query /healthz and /readyz of a running server
+  help                                  Show this help
+`
 
 // MustGetenv retrieves the environment variable or terminates the application if not present or empty
 func MustGetenv(key string) string {
@@ -29,73 +50,372 @@ func MustGetenv(key string) string {
 }
 
 func main() {
-	log.Info("Starting up")
+	command := "serve"
+	args := os.Args[1:]
+	if len(args) > 0 {
+		command, args = args[0], args[1:]
+	}
 
-	// Initialize SolarWeb client
-	pvSystemId := MustGetenv("SOLAR_WEB_PV_SYSTEM_ID")
-	authCookieFilename := os.Getenv("SOLAR_WEB_AUTH_COOKIE_FILE")
-	if authCookieFilename == "" {
-		authCookieFilename = "/tmp/solarizer/authcookie"
+	switch command {
+	case "serve":
+		runServe()
+	case "login":
+		runLogin()
+	case "fetch":
+		runFetch(args)
+	case "cookie":
+		runCookie(args)
+	case "backfill":
+		runBackfill(args)
+	case "export":
+		runExport(args)
+	case "healthcheck":
+		runHealthcheck(args)
+	case "help", "-h", "--help":
+		fmt.Print(usage)
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown command %q\n\n%s", command, usage)
+		os.Exit(2)
 	}
+}
+
+// authCookieFilename returns the file the auth cookie is persisted in.
+func authCookieFilename() string {
+	return getenvDefault("SOLAR_WEB_AUTH_COOKIE_FILE", "/tmp/solarizer/authcookie")
+}
+
+// newSolarWebClient creates a SolarWeb client from the environment.
+func newSolarWebClient() *solarweb.SolarWeb {
+	pvSystemId := MustGetenv("SOLAR_WEB_PV_SYSTEM_ID")
 	solarWebUsername := MustGetenv("SOLAR_WEB_USERNAME")
 	solarWebPassword := MustGetenv("SOLAR_WEB_PASSWORD")
-	solarWebClient = solarweb.New(pvSystemId, authCookieFilename, solarWebUsername, solarWebPassword)
+	client := solarweb.New(pvSystemId, authCookieFilename(), solarWebUsername, solarWebPassword)
 	if authCookie, ok := os.LookupEnv("SOLAR_WEB_AUTH_COOKIE"); ok {
-		solarWebClient.SetAuthCookie(authCookie)
+		client.SetAuthCookie(authCookie)
 	}
 	log.Info("SolarWeb client initialized", "pvSystemId", pvSystemId)
+	return client
+}
 
-	// Create importer
-	var importer *influx.Importer
-	if os.Getenv("DISABLE_INFLUX_IMPORTER") == "true" {
-		log.Info("Influx importer disabled")
-	} else {
-		dbConfig := influx.DBConfig{
-			Url:    MustGetenv("INFLUX_URL"),
-			Token:  MustGetenv("INFLUX_TOKEN"),
-			Org:    MustGetenv("INFLUX_ORG"),
-			Bucket: MustGetenv("INFLUX_BUCKET"),
+// newSinks creates all sinks configured in the environment and terminates the
+// application if none is configured. The history store is returned separately
+// as it also answers queries, it is nil if not configured.
+func newSinks() ([]influx.Sink, *history.Store) {
+	var sinks []influx.Sink
+	if os.Getenv("INFLUX_URL") != "" {
+		sink, err := influx.NewInfluxSink(influxConfig())
+		if err != nil {
+			log.Fatal("Unable to initialize Influx sink", "err", err)
+		}
+		sinks = append(sinks, sink)
+	}
+	if os.Getenv("LINE_PROTOCOL_URL") != "" {
+		sinks = append(sinks, influx.NewLineProtocolSink(lineProtocolConfig()))
+	}
+	if url := os.Getenv("POSTGRES_URL"); url != "" {
+		sink, err := postgres.NewSink(postgres.Config{
+			Url:         url,
+			Schema:      os.Getenv("POSTGRES_SCHEMA"),
+			TimescaleDB: os.Getenv("POSTGRES_TIMESCALEDB") == "true",
+		})
+		if err != nil {
+			log.Fatal("Unable to initialize Postgres sink", "err", err)
 		}
-		importer = influx.NewImporter(dbConfig, solarWebClient)
-		log.Info("Influx importer initialized")
+		sinks = append(sinks, sink)
+	}
+	var historyStore *history.Store
+	if filename := os.Getenv("HISTORY_DB"); filename != "" {
+		var err error
+		historyStore, err = history.Open(history.Config{
+			Filename:        filename,
+			RawRetention:    getenvDurationDefault("HISTORY_RAW_RETENTION", 7*24*time.Hour),
+			HourlyRetention: getenvDuration("HISTORY_HOURLY_RETENTION"),
+		})
+		if err != nil {
+			log.Fatal("Unable to open history", "err", err)
+		}
+		sinks = append(sinks, historyStore)
+	}
+	if len(sinks) == 0 {
+		log.Fatal("No sink configured, set INFLUX_URL, LINE_PROTOCOL_URL, POSTGRES_URL or HISTORY_DB")
 	}
+	return sinks, historyStore
+}
 
-	// Create api
-	var api *apiserver.ApiServer
-	if os.Getenv("DISABLE_API_SERVER") == "true" {
-		log.Info("API server disabled")
-	} else {
-		api = apiserver.New(apiServerAddr, solarWebClient)
-		log.Info("API server initialized", "addr", apiServerAddr)
+// newHistorySource opens the local history database if HISTORY_DB is set,
+// otherwise history queries are sent to Influx. The returned function closes
+// the source.
+func newHistorySource() (history.Source, func()) {
+	if filename := os.Getenv("HISTORY_DB"); filename != "" {
+		store, err := history.Open(history.Config{Filename: filename})
+		if err != nil {
+			log.Fatal("Unable to open history", "err", err)
+		}
+		return store, store.Close
+	}
+	if os.Getenv("INFLUX_URL") != "" {
+		source := history.NewInfluxSource(influxConfig())
+		return source, source.Close
 	}
+	log.Fatal("No history configured, set HISTORY_DB or INFLUX_URL")
+	return nil, nil
+}
 
-	// Create a channel to capture SIGTERM, SIGINT
-	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, syscall.SIGTERM, syscall.SIGINT)
-	// Create a context listening to SIGTERM, SIGINT
-	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
-	defer stop()
+// influxConfig reads the Influx database configuration from the environment.
+// If INFLUX_DATABASE is set, an InfluxDB 1.x target is configured.
+func influxConfig() influx.DBConfig {
+	dbConfig := influx.DBConfig{
+		Url:              MustGetenv("INFLUX_URL"),
+		Database:         os.Getenv("INFLUX_DATABASE"),
+		RetentionPolicy:  os.Getenv("INFLUX_RETENTION_POLICY"),
+		Username:         os.Getenv("INFLUX_USERNAME"),
+		Password:         os.Getenv("INFLUX_PASSWORD"),
+		MaxRetries:       getenvUint("INFLUX_MAX_RETRIES"),
+		RetryInterval:    getenvDuration("INFLUX_RETRY_INTERVAL"),
+		MaxRetryInterval: getenvDuration("INFLUX_MAX_RETRY_INTERVAL"),
+		MaxRetryTime:     getenvDuration("INFLUX_MAX_RETRY_TIME"),
+		RetryBufferLimit: getenvUint("INFLUX_RETRY_BUFFER_LIMIT"),
+		SpoolDir:         os.Getenv("INFLUX_SPOOL_DIR"),
+		SpoolMaxBytes:    int64(getenvUint("INFLUX_SPOOL_MAX_BYTES")),
+	}
+	if !dbConfig.IsV1() {
+		dbConfig.Token = MustGetenv("INFLUX_TOKEN")
+		dbConfig.Org = MustGetenv("INFLUX_ORG")
+		dbConfig.Bucket = MustGetenv("INFLUX_BUCKET")
+	}
+	return dbConfig
+}
 
-	// Run tasks asynchronously
-	if api != nil {
-		go api.ListenAndServe()
+// lineProtocolConfig reads the line protocol endpoint from the environment.
+func lineProtocolConfig() influx.LineProtocolConfig {
+	config := influx.LineProtocolConfig{
+		Url:     MustGetenv("LINE_PROTOCOL_URL"),
+		Headers: make(map[string]string),
+		Gzip:    os.Getenv("LINE_PROTOCOL_GZIP") == "true",
 	}
-	if importer != nil {
-		go importer.RunImportLoop(ctx)
+	if headers := os.Getenv("LINE_PROTOCOL_HEADERS"); headers != "" {
+		for _, header := range strings.Split(headers, ",") {
+			name, value, ok := strings.Cut(header, ":")
+			if !ok {
+				log.Fatal("Invalid header in LINE_PROTOCOL_HEADERS, expected Name: Value", "header", header)
+			}
+			config.Headers[strings.TrimSpace(name)] = strings.TrimSpace(value)
+		}
 	}
+	switch precision := os.Getenv("LINE_PROTOCOL_PRECISION"); precision {
+	case "", "ns":
+		config.Precision = time.Nanosecond
+	case "us":
+		config.Precision = time.Microsecond
+	case "ms":
+		config.Precision = time.Millisecond
+	case "s":
+		config.Precision = time.Second
+	default:
+		log.Fatal("Invalid LINE_PROTOCOL_PRECISION, expected ns, us, ms or s", "precision", precision)
+	}
+	return config
+}
 
-	// Block and wait for signal
-	sig := <-quit
-	log.Info("Shutting down", "signal", sig)
+// tariffConfig reads the electricity tariff, its time-of-use windows and the
+// dynamic price feed from the environment. It reports false if neither an
+// import price, time-of-use windows nor a price feed is configured.
+func tariffConfig() (tariff.Tariff, bool) {
+	windows, err := tariff.ParseWindows(os.Getenv("TARIFF_TIME_OF_USE"))
+	if err != nil {
+		log.Fatal("Invalid environment variable", "name", "TARIFF_TIME_OF_USE", "err", err)
+	}
+	t := tariff.Tariff{
+		Currency:       getenvDefault("TARIFF_CURRENCY", "EUR"),
+		ImportPrice:    getenvFloat("TARIFF_IMPORT_PRICE"),
+		FeedInPrice:    getenvFloat("TARIFF_FEED_IN_PRICE"),
+		TimeOfUse:      windows,
+		MonthlyBaseFee: getenvFloat("TARIFF_MONTHLY_BASE_FEE"),
+	}
+	if source := os.Getenv("TARIFF_PRICES_URL"); source != "" {
+		refresh := getenvDurationDefault("TARIFF_PRICES_REFRESH", time.Hour)
+		if refresh <= 0 {
+			log.Fatal("Invalid environment variable", "name", "TARIFF_PRICES_REFRESH", "err", "must be positive")
+		}
+		t.Prices = tariff.NewPriceFeed(source, refresh)
+	}
+	return t, t.ImportPrice > 0 || len(t.TimeOfUse) > 0 || t.Prices != nil
+}
 
-	// Shutdown api server
-	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-	if api != nil {
-		if err := api.Shutdown(shutdownCtx); err != nil {
-			log.Error("Shutdown of API server failed", "err", err)
+// alertConfig creates the alert engine from the environment. It returns nil
+// if no notification channel is configured.
+func alertConfig(status func() solarweb.Status, detector *anomaly.Detector, staleAfter time.Duration) *alert.Engine {
+	var notifiers []alert.Notifier
+	if url := os.Getenv("ALERT_WEBHOOK_URL"); url != "" {
+		notifiers = append(notifiers, alert.NewWebhookNotifier(url))
+	}
+	if url := os.Getenv("ALERT_NTFY_URL"); url != "" {
+		notifiers = append(notifiers, alert.NewNtfyNotifier(url, os.Getenv("ALERT_NTFY_TOKEN")))
+	}
+	if os.Getenv("ALERT_SMTP_ADDR") != "" {
+		notifiers = append(notifiers, alert.NewSMTPNotifier(smtpConfig("ALERT_SMTP_TO")))
+	}
+	if len(notifiers) == 0 {
+		return nil
+	}
+
+	var rules []alert.Rule
+	// Systems without battery report a state of charge of 0
+	defaultRules := "offline,pv_zero,login_failing,production_anomaly"
+	if os.Getenv("BATTERY_CAPACITY") != "" {
+		defaultRules = "offline,battery_low,pv_zero,login_failing,production_anomaly"
+	}
+	for _, name := range strings.Split(getenvDefault("ALERT_RULES", defaultRules), ",") {
+		switch strings.TrimSpace(name) {
+		case "offline":
+			rules = append(rules, alert.OfflineRule(getenvDurationDefault("ALERT_OFFLINE_FOR", 5*time.Minute)))
+		case "battery_low":
+			below := getenvFloatDefault("ALERT_BATTERY_LOW_BELOW", 10)
+			rules = append(rules, alert.BatteryLowRule(below, getenvFloatDefault("ALERT_BATTERY_LOW_CLEAR", below+5),
+				getenvDurationDefault("ALERT_BATTERY_LOW_FOR", 2*time.Minute)))
+		case "pv_zero":
+			start, end, err := alert.ParseDailyWindow(getenvDefault("ALERT_PV_ZERO_WINDOW", "11:00-14:00"))
+			if err != nil {
+				log.Fatal("Invalid environment variable", "name", "ALERT_PV_ZERO_WINDOW", "err", err)
+			}
+			rules = append(rules, alert.PVZeroRule(start, end, getenvDurationDefault("ALERT_PV_ZERO_FOR", 30*time.Minute)))
+		case "login_failing":
+			rules = append(rules, alert.LoginFailingRule(int(getenvUintDefault("ALERT_LOGIN_FAILURES", 3))))
+		case "production_anomaly":
+			if detector != nil {
+				rules = append(rules, alert.ProductionAnomalyRule(detector))
+			}
+		case "":
+		default:
+			log.Fatal("Invalid environment variable", "name", "ALERT_RULES", "err", fmt.Sprintf("unknown rule %q", name))
 		}
 	}
+	return alert.NewEngine(rules, notifiers, status, staleAfter)
+}
 
-	log.Info("Shutdown complete")
+// reportConfig configures the reports from the environment. It reports false
+// if REPORT_DIR is not set.
+func reportConfig() (report.Config, []report.Deliverer, bool) {
+	config := report.Config{Dir: os.Getenv("REPORT_DIR")}
+	if config.Dir == "" {
+		return config, nil, false
+	}
+	at, err := time.Parse("15:04", getenvDefault("REPORT_TIME", "21:00"))
+	if err != nil {
+		log.Fatal("Invalid environment variable", "name", "REPORT_TIME", "err", err)
+	}
+	config.At = time.Duration(at.Hour())*time.Hour + time.Duration(at.Minute())*time.Minute
+	if os.Getenv("REPORT_LATITUDE") != "" && os.Getenv("REPORT_LONGITUDE") != "" {
+		config.Sun = true
+		config.Latitude = getenvFloat("REPORT_LATITUDE")
+		config.Longitude = getenvFloat("REPORT_LONGITUDE")
+		config.AfterSunset = getenvDurationDefault("REPORT_AFTER_SUNSET", time.Hour)
+	}
+
+	var deliverers []report.Deliverer
+	if url := os.Getenv("REPORT_WEBHOOK_URL"); url != "" {
+		deliverers = append(deliverers, report.NewWebhookDeliverer(url))
+	}
+	if os.Getenv("REPORT_SMTP_TO") != "" {
+		deliverers = append(deliverers, report.NewMailDeliverer(smtpConfig("REPORT_SMTP_TO")))
+	}
+	return config, deliverers, true
+}
+
+// forecastConfig describes the PV array and the days of history the forecast
+// is calibrated with from the environment. It reports false if
+// FORECAST_PEAK_POWER is not set.
+func forecastConfig() (forecast.System, int, bool) {
+	if os.Getenv("FORECAST_PEAK_POWER") == "" {
+		return forecast.System{}, 0, false
+	}
+	// A missing position would silently forecast for 0°N 0°E
+	MustGetenv("FORECAST_LATITUDE")
+	MustGetenv("FORECAST_LONGITUDE")
+	days := getenvUintDefault("FORECAST_CALIBRATION_DAYS", 14)
+	if days == 0 {
+		log.Fatal("Invalid environment variable", "name", "FORECAST_CALIBRATION_DAYS", "err", "must be positive")
+	}
+	return forecast.System{
+		Latitude:  getenvFloat("FORECAST_LATITUDE"),
+		Longitude: getenvFloat("FORECAST_LONGITUDE"),
+		Tilt:      getenvFloatDefault("FORECAST_TILT", 30),
+		Azimuth:   getenvFloatDefault("FORECAST_AZIMUTH", 180),
+		PeakPower: getenvFloat("FORECAST_PEAK_POWER"),
+	}, int(days), true
+}
+
+// smtpConfig returns the SMTP server configured by ALERT_SMTP_* with the
+// comma-separated recipients of the environment variable toKey.
+func smtpConfig(toKey string) mail.Config {
+	return mail.Config{
+		Addr:     MustGetenv("ALERT_SMTP_ADDR"),
+		Username: os.Getenv("ALERT_SMTP_USERNAME"),
+		Password: os.Getenv("ALERT_SMTP_PASSWORD"),
+		From:     MustGetenv("ALERT_SMTP_FROM"),
+		To:       strings.Split(MustGetenv(toKey), ","),
+	}
+}
+
+// getenvDefault returns the environment variable, or the default if it is not
+// set
+func getenvDefault(key string, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+// getenvUint parses an optional unsigned integer environment variable, it
+// returns 0 if the variable is not set
+func getenvUint(key string) uint {
+	return getenvUintDefault(key, 0)
+}
+
+func getenvUintDefault(key string, defaultValue uint) uint {
+	env := os.Getenv(key)
+	if env == "" {
+		return defaultValue
+	}
+	value, err := strconv.ParseUint(env, 10, 0)
+	if err != nil {
+		log.Fatal("Invalid environment variable", "name", key, "err", err)
+	}
+	return uint(value)
+}
+
+func getenvFloat(key string) float64 {
+	return getenvFloatDefault(key, 0)
+}
+
+func getenvFloatDefault(key string, defaultValue float64) float64 {
+	env := os.Getenv(key)
+	if env == "" {
+		return defaultValue
+	}
+	value, err := strconv.ParseFloat(env, 64)
+	if err != nil {
+		log.Fatal("Invalid environment variable", "name", key, "err", err)
+	}
+	return value
+}
+
+// getenvDuration parses an optional duration environment variable like "5s",
+// it returns 0 if the variable is not set
+func getenvDuration(key string) time.Duration {
+	return getenvDurationDefault(key, 0)
+}
+
+// getenvDurationDefault parses an optional duration environment variable like
+// "5s", it returns the default if the variable is not set
+func getenvDurationDefault(key string, defaultValue time.Duration) time.Duration {
+	env := os.Getenv(key)
+	if env == "" {
+		return defaultValue
+	}
+	value, err := time.ParseDuration(env)
+	if err != nil {
+		log.Fatal("Invalid environment variable", "name", key, "err", err)
+	}
+	return value
 }
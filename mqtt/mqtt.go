@@ -0,0 +1,138 @@
+package mqtt
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+)
+
+const (
+	keepAlive = 60 // seconds
+	packetID  = 1  // every connection publishes a single message
+)
+
+// Config configures the broker.
+type Config struct {
+	Broker   string // host:port, optionally with scheme tcp://, mqtt://, ssl://, tls:// or mqtts://
+	Username string // optional
+	Password string
+	ClientID string // must be unique among concurrent connections, the broker drops older ones
+}
+
+// Publish connects to the broker, publishes the payload with QoS 1, waits for
+// the acknowledgement and disconnects. It implements the subset of MQTT 3.1.1
+// needed to switch devices that change their state rarely.
+func Publish(ctx context.Context, config Config, topic string, payload []byte, retain bool) error {
+	conn, err := dial(ctx, config.Broker)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	if _, err := conn.Write(connectPacket(config)); err != nil {
+		return err
+	}
+	var connack [4]byte
+	if _, err := io.ReadFull(conn, connack[:]); err != nil {
+		return fmt.Errorf("reading CONNACK: %w", err)
+	}
+	if connack[0] != 0x20 || connack[1] != 0x02 {
+		return errors.New("unexpected response to CONNECT")
+	}
+	if code := connack[3]; code != 0 {
+		return fmt.Errorf("connection refused with code %d", code)
+	}
+
+	var variable bytes.Buffer
+	writeString(&variable, topic)
+	variable.Write([]byte{packetID >> 8, packetID & 0xff})
+	variable.Write(payload)
+	header := byte(0x32) // QoS 1
+	if retain {
+		header |= 0x01
+	}
+	if _, err := conn.Write(packet(header, variable.Bytes())); err != nil {
+		return err
+	}
+	var puback [4]byte
+	if _, err := io.ReadFull(conn, puback[:]); err != nil {
+		return fmt.Errorf("reading PUBACK: %w", err)
+	}
+	if puback != [4]byte{0x40, 0x02, packetID >> 8, packetID & 0xff} {
+		return errors.New("unexpected response to PUBLISH")
+	}
+	_, err = conn.Write(packet(0xe0, nil))
+	return err
+}
+
+func dial(ctx context.Context, broker string) (net.Conn, error) {
+	scheme, addr, found := strings.Cut(broker, "://")
+	if !found {
+		scheme, addr = "tcp", broker
+	}
+	dialer := &net.Dialer{}
+	switch scheme {
+	case "tcp", "mqtt":
+		return dialer.DialContext(ctx, "tcp", addr)
+	case "ssl", "tls", "mqtts":
+		host, _, _ := net.SplitHostPort(addr)
+		tlsDialer := &tls.Dialer{NetDialer: dialer, Config: &tls.Config{ServerName: host}}
+		return tlsDialer.DialContext(ctx, "tcp", addr)
+	default:
+		return nil, fmt.Errorf("unsupported broker scheme %q", scheme)
+	}
+}
+
+func connectPacket(config Config) []byte {
+	var variable bytes.Buffer
+	writeString(&variable, "MQTT")
+	variable.WriteByte(4) // protocol level 3.1.1
+	flags := byte(0x02)   // clean session
+	if config.Username != "" {
+		flags |= 0x80
+		if config.Password != "" {
+			flags |= 0x40
+		}
+	}
+	variable.WriteByte(flags)
+	variable.Write([]byte{keepAlive >> 8, keepAlive & 0xff})
+	writeString(&variable, config.ClientID)
+	if config.Username != "" {
+		writeString(&variable, config.Username)
+		if config.Password != "" {
+			writeString(&variable, config.Password)
+		}
+	}
+	return packet(0x10, variable.Bytes())
+}
+
+// packet prepends the fixed header with the remaining length.
+func packet(header byte, body []byte) []byte {
+	buf := []byte{header}
+	length := len(body)
+	for {
+		b := byte(length % 128)
+		length /= 128
+		if length > 0 {
+			b |= 0x80
+		}
+		buf = append(buf, b)
+		if length == 0 {
+			break
+		}
+	}
+	return append(buf, body...)
+}
+
+func writeString(buf *bytes.Buffer, s string) {
+	buf.Write([]byte{byte(len(s) >> 8), byte(len(s))})
+	buf.WriteString(s)
+}
@@ -0,0 +1,131 @@
+package mqtt
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+type published struct {
+	clientID, username, password, topic, payload string
+	retain                                       bool
+	qos                                          byte
+}
+
+// serveBroker accepts one connection and decodes CONNECT and PUBLISH. It
+// acknowledges publications unless ack is false.
+func serveBroker(t *testing.T, listener net.Listener, result chan<- published, ack bool) {
+	conn, err := listener.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	var p published
+	for {
+		header, err := reader.ReadByte()
+		if err != nil {
+			result <- p
+			return
+		}
+		length, multiplier := 0, 1
+		for {
+			b, _ := reader.ReadByte()
+			length += int(b&0x7f) * multiplier
+			multiplier *= 128
+			if b&0x80 == 0 {
+				break
+			}
+		}
+		body := make([]byte, length)
+		if _, err := io.ReadFull(reader, body); err != nil {
+			t.Error(err)
+			return
+		}
+		readString := func() string {
+			n := int(body[0])<<8 | int(body[1])
+			s := string(body[2 : 2+n])
+			body = body[2+n:]
+			return s
+		}
+		switch header & 0xf0 {
+		case 0x10:
+			if name := readString(); name != "MQTT" || body[0] != 4 {
+				t.Errorf("protocol %q level %d", name, body[0])
+			}
+			flags := body[1]
+			body = body[4:]
+			p.clientID = readString()
+			if flags&0x80 != 0 {
+				p.username = readString()
+			}
+			if flags&0x40 != 0 {
+				p.password = readString()
+			}
+			_, _ = conn.Write([]byte{0x20, 0x02, 0x00, 0x00})
+		case 0x30:
+			p.retain = header&0x01 != 0
+			p.qos = header >> 1 & 0x03
+			p.topic = readString()
+			id := body[:2]
+			p.payload = string(body[2:])
+			if !ack {
+				result <- p
+				return
+			}
+			_, _ = conn.Write([]byte{0x40, 0x02, id[0], id[1]})
+		case 0xe0:
+			result <- p
+			return
+		}
+	}
+}
+
+func TestPublish(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	result := make(chan published, 1)
+	go serveBroker(t, listener, result, true)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	config := Config{Broker: "tcp://" + listener.Addr().String(), Username: "solar", Password: "secret", ClientID: "solarizer"}
+	if err := Publish(ctx, config, "cmnd/heater/POWER", []byte("ON"), true); err != nil {
+		t.Fatalf("Publish returned error: %v", err)
+	}
+	got := <-result
+	want := published{clientID: "solarizer", username: "solar", password: "secret", topic: "cmnd/heater/POWER", payload: "ON", retain: true, qos: 1}
+	if got != want {
+		t.Fatalf("broker received %+v, want %+v", got, want)
+	}
+}
+
+func TestPublishWithoutAcknowledgement(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	result := make(chan published, 1)
+	go serveBroker(t, listener, result, false)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	// The broker drops the connection, e.g. due to a takeover of the client ID
+	if err := Publish(ctx, Config{Broker: listener.Addr().String(), ClientID: "solarizer"}, "cmnd/heater/POWER", []byte("ON"), true); err == nil {
+		t.Fatal("Publish returned no error without PUBACK")
+	}
+	<-result
+}
+
+func TestPacketRemainingLength(t *testing.T) {
+	if p := packet(0x30, make([]byte, 321)); p[1] != 0xc1 || p[2] != 0x02 || len(p) != 324 {
+		t.Fatalf("header = % x, want 30 c1 02", p[:3])
+	}
+}
@@ -0,0 +1,182 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	influxdb2 "github.com/influxdata/influxdb-client-go/v2"
+	"github.com/influxdata/influxdb-client-go/v2/api/write"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// newTestSink returns a sink without database whose inserts are handled by
+// insert.
+func newTestSink(insert func(points []*write.Point) error) *Sink {
+	s := &Sink{config: Config{Schema: "solar"}}
+	s.insert = func(_ context.Context, points []*write.Point) error { return insert(points) }
+	return s
+}
+
+func point(value float64) *write.Point {
+	return influxdb2.NewPointWithMeasurement("power").AddField("power_pv", value).SetTime(time.Unix(1700000000, 0))
+}
+
+func values(points []*write.Point) []float64 {
+	var values []float64
+	for _, p := range points {
+		values = append(values, p.FieldList()[0].Value.(float64))
+	}
+	return values
+}
+
+func TestStatements(t *testing.T) {
+	s := &Sink{config: Config{Schema: "solar"}}
+	table := s.table("power")
+	if table != `"solar"."power"` {
+		t.Fatalf("table = %s", table)
+	}
+
+	statement, args := insertStatement(table, influxdb2.NewPointWithMeasurement("power").
+		AddTag("is_online", "true").
+		AddField("power_pv", 1200.0).
+		AddField("count", int64(3)).
+		SetTime(time.Unix(1700000000, 0)))
+	if want := `INSERT INTO "solar"."power" (time, "is_online", "power_pv", "count") VALUES ($1, $2, $3, $4)`; statement != want {
+		t.Errorf("insert = %s, want %s", statement, want)
+	}
+	if want := []any{time.Unix(1700000000, 0), "true", 1200.0, int64(3)}; !reflect.DeepEqual(args, want) {
+		t.Errorf("values = %v, want %v", args, want)
+	}
+
+	if want := []string{
+		`CREATE TABLE IF NOT EXISTS "solar"."power" (time timestamptz NOT NULL)`,
+		`CREATE INDEX IF NOT EXISTS "power_time_idx" ON "solar"."power" (time)`,
+	}; !reflect.DeepEqual(createTableStatements(table, "power", false), want) {
+		t.Errorf("create table = %q, want %q", createTableStatements(table, "power", false), want)
+	}
+	if got := createTableStatements(table, "power", true)[1]; got != `SELECT create_hypertable('"solar"."power"', 'time', if_not_exists => TRUE)` {
+		t.Errorf("create hypertable = %s", got)
+	}
+	if got := addColumnStatement(table, `we"ird`, "text"); got != `ALTER TABLE "solar"."power" ADD COLUMN IF NOT EXISTS "we""ird" text` {
+		t.Errorf("add column = %s", got)
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	for _, test := range []struct {
+		err  error
+		want bool
+	}{
+		{errors.New("connection refused"), true},
+		{&pgconn.PgError{Code: "08006"}, true},  // connection failure
+		{&pgconn.PgError{Code: "53100"}, true},  // disk full
+		{&pgconn.PgError{Code: "40001"}, true},  // serialization failure
+		{&pgconn.PgError{Code: "22P02"}, false}, // invalid text representation
+		{&pgconn.PgError{Code: "42804"}, false}, // datatype mismatch
+	} {
+		if got := isRetryable(test.err); got != test.want {
+			t.Errorf("isRetryable(%v) = %v, want %v", test.err, got, test.want)
+		}
+	}
+}
+
+func TestRetryKeepsOrder(t *testing.T) {
+	var s *Sink
+	var inserted []*write.Point
+	failures := 1
+	s = newTestSink(func(points []*write.Point) error {
+		if failures > 0 {
+			failures--
+			// A point is written while the batch is inserted
+			s.WritePoint(point(3))
+			return &pgconn.PgError{Code: "08006"}
+		}
+		inserted = append(inserted, points...)
+		return nil
+	})
+	s.WritePoint(point(1))
+	s.WritePoint(point(2))
+
+	if s.flushPoints(context.Background()) {
+		t.Fatal("flushPoints reported success of a failed insert")
+	}
+	for s.flushPoints(context.Background()) {
+	}
+	if want := []float64{1, 2, 3}; !reflect.DeepEqual(values(inserted), want) {
+		t.Fatalf("inserted %v, want %v", values(inserted), want)
+	}
+	if stats := s.Stats(); stats.Retries != 1 || stats.Discarded != 0 {
+		t.Fatalf("Stats() = %+v, want one retry", stats)
+	}
+}
+
+func TestBufferIsBounded(t *testing.T) {
+	var s *Sink
+	s = newTestSink(func(points []*write.Point) error {
+		// The buffer fills up while the batch is inserted
+		for len(s.points) < maxBuffer {
+			s.points = append(s.points, point(2))
+		}
+		return errors.New("connection refused")
+	})
+	for range maxBuffer + 10 {
+		s.WritePoint(point(1))
+	}
+	if len(s.points) != maxBuffer || s.Stats().Discarded != 10 {
+		t.Fatalf("buffered %d points, discarded %d, want %d and 10", len(s.points), s.Stats().Discarded, maxBuffer)
+	}
+
+	s.points = s.points[:batchSize]
+	s.flushPoints(context.Background())
+	if len(s.points) != maxBuffer || s.Stats().Discarded != 10+batchSize {
+		t.Fatalf("buffered %d points, discarded %d, want %d and %d", len(s.points), s.Stats().Discarded, maxBuffer, 10+batchSize)
+	}
+	// The oldest points of the retried batch are dropped
+	if values(s.points[:1])[0] != 2 {
+		t.Fatal("retried batch was kept instead of the newer points")
+	}
+}
+
+func TestDrainDiscardsPointsLeft(t *testing.T) {
+	s := newTestSink(func(points []*write.Point) error {
+		return errors.New("connection refused")
+	})
+	for range batchSize + 10 {
+		s.WritePoint(point(1))
+	}
+	s.drain()
+
+	// The drain stops at the first failed insert
+	if stats := s.Stats(); len(s.points) != 0 || stats.Discarded != batchSize+10 {
+		t.Fatalf("Stats() = %+v, want all points discarded", stats)
+	}
+}
+
+func TestRejectedPointIsDiscardedAlone(t *testing.T) {
+	var inserted []*write.Point
+	s := newTestSink(func(points []*write.Point) error {
+		for _, p := range points {
+			if values([]*write.Point{p})[0] == 2 {
+				return &pgconn.PgError{Code: "22P02"}
+			}
+		}
+		inserted = append(inserted, points...)
+		return nil
+	})
+	for i := 1; i <= 3; i++ {
+		s.WritePoint(point(float64(i)))
+	}
+
+	if !s.flushPoints(context.Background()) {
+		t.Fatal("flushPoints reported a retryable failure")
+	}
+	if want := []float64{1, 3}; !reflect.DeepEqual(values(inserted), want) {
+		t.Fatalf("inserted %v, want %v", values(inserted), want)
+	}
+	if stats := s.Stats(); stats.Discarded != 1 || stats.WriteErrors != 1 || stats.Retries != 0 {
+		t.Fatalf("Stats() = %+v, want one error and one discarded point", stats)
+	}
+}
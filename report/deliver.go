@@ -0,0 +1,81 @@
+package report
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"solarizer/mail"
+	"strings"
+	"time"
+)
+
+// Deliverer sends a report to a channel.
+type Deliverer interface {
+	Name() string
+	Deliver(ctx context.Context, s Summary) error
+}
+
+// WebhookDeliverer posts the summary as JSON with the Markdown report in the
+// additional key "markdown".
+type WebhookDeliverer struct {
+	url    string
+	client *http.Client
+}
+
+func NewWebhookDeliverer(url string) *WebhookDeliverer {
+	return &WebhookDeliverer{url: url, client: &http.Client{Timeout: 30 * time.Second}}
+}
+
+func (d *WebhookDeliverer) Name() string {
+	return "webhook"
+}
+
+func (d *WebhookDeliverer) Deliver(ctx context.Context, s Summary) error {
+	body, err := json.Marshal(struct {
+		Summary
+		Markdown string `json:"markdown"`
+	}{s, s.Markdown()})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("unexpected status %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// MailDeliverer sends the HTML report as mail.
+type MailDeliverer struct {
+	config mail.Config
+}
+
+func NewMailDeliverer(config mail.Config) *MailDeliverer {
+	return &MailDeliverer{config: config}
+}
+
+func (d *MailDeliverer) Name() string {
+	return "mail"
+}
+
+func (d *MailDeliverer) Deliver(ctx context.Context, s Summary) error {
+	return mail.Send(ctx, d.config, mail.Message{
+		Subject:     "[solarizer] Solar report " + s.Period,
+		ContentType: "text/html; charset=utf-8",
+		Date:        time.Now(),
+		Body:        s.HTML(),
+	})
+}
@@ -0,0 +1,116 @@
+package report
+
+import (
+	"bytes"
+	"fmt"
+	htmltemplate "html/template"
+	"text/template"
+	"time"
+)
+
+var funcs = template.FuncMap{
+	"kwh":   func(wh float64) string { return fmt.Sprintf("%.2f kWh", wh/1000) },
+	"kw":    func(w float64) string { return fmt.Sprintf("%.2f kW", w/1000) },
+	"pct":   func(rate float64) string { return fmt.Sprintf("%.0f %%", rate*100) },
+	"money": func(amount float64) string { return fmt.Sprintf("%.2f", amount) },
+	"at": func(t time.Time, s Summary) string {
+		if s.Days > 0 {
+			return t.Format("2006-01-02 15:04")
+		}
+		return t.Format("15:04")
+	},
+}
+
+const markdownTemplate = `# Solar report {{.Period}}
+
+| Energy | |
+|---|---|
+| Production | {{kwh .Energy.PV}} |
+| Consumption | {{kwh .Energy.Load}} |
+| Grid import | {{kwh .Energy.GridImport}} |
+| Grid export | {{kwh .Energy.GridExport}} |
+| Battery charge | {{kwh .Energy.BatteryCharge}} |
+| Battery discharge | {{kwh .Energy.BatteryDischarge}} |
+| Self-consumption rate | {{pct .Energy.SelfConsumptionRate}} |
+| Autarky | {{pct .Energy.Autarky}} |
+
+| Peak power | | |
+|---|---|---|
+| Production | {{kw .Peaks.PV.Power}} | {{at .Peaks.PV.Time .}} |
+| Consumption | {{kw .Peaks.Load.Power}} | {{at .Peaks.Load.Time .}} |
+| Grid import | {{kw .Peaks.GridImport.Power}} | {{at .Peaks.GridImport.Time .}} |
+| Grid export | {{kw .Peaks.GridExport.Power}} | {{at .Peaks.GridExport.Time .}} |
+{{- with .Costs}}
+
+| Costs | {{$.Currency}} |
+|---|---|
+| Grid import | {{money .Import}} |
+| Feed-in | {{money .FeedIn}} |
+| Base fee | {{money .BaseFee}} |
+| Net | {{money .Net}} |
+| Savings | {{money .Savings}} |
+{{- end}}
+{{- if .Days}}
+
+Compiled from {{.Days}} daily reports.
+{{- end}}
+`
+
+const htmlTemplate = `<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Solar report {{.Period}}</title></head>
+<body style="font-family: sans-serif">
+<h1>Solar report {{.Period}}</h1>
+<table>
+<tr><th colspan="2" align="left">Energy</th></tr>
+<tr><td>Production</td><td>{{kwh .Energy.PV}}</td></tr>
+<tr><td>Consumption</td><td>{{kwh .Energy.Load}}</td></tr>
+<tr><td>Grid import</td><td>{{kwh .Energy.GridImport}}</td></tr>
+<tr><td>Grid export</td><td>{{kwh .Energy.GridExport}}</td></tr>
+<tr><td>Battery charge</td><td>{{kwh .Energy.BatteryCharge}}</td></tr>
+<tr><td>Battery discharge</td><td>{{kwh .Energy.BatteryDischarge}}</td></tr>
+<tr><td>Self-consumption rate</td><td>{{pct .Energy.SelfConsumptionRate}}</td></tr>
+<tr><td>Autarky</td><td>{{pct .Energy.Autarky}}</td></tr>
+<tr><th colspan="2" align="left">Peak power</th></tr>
+<tr><td>Production</td><td>{{kw .Peaks.PV.Power}} at {{at .Peaks.PV.Time .}}</td></tr>
+<tr><td>Consumption</td><td>{{kw .Peaks.Load.Power}} at {{at .Peaks.Load.Time .}}</td></tr>
+<tr><td>Grid import</td><td>{{kw .Peaks.GridImport.Power}} at {{at .Peaks.GridImport.Time .}}</td></tr>
+<tr><td>Grid export</td><td>{{kw .Peaks.GridExport.Power}} at {{at .Peaks.GridExport.Time .}}</td></tr>
+{{- with .Costs}}
+<tr><th colspan="2" align="left">Costs in {{$.Currency}}</th></tr>
+<tr><td>Grid import</td><td>{{money .Import}}</td></tr>
+<tr><td>Feed-in</td><td>{{money .FeedIn}}</td></tr>
+<tr><td>Base fee</td><td>{{money .BaseFee}}</td></tr>
+<tr><td>Net</td><td>{{money .Net}}</td></tr>
+<tr><td>Savings</td><td>{{money .Savings}}</td></tr>
+{{- end}}
+</table>
+{{- if .Days}}
+<p>Compiled from {{.Days}} daily reports.</p>
+{{- end}}
+</body>
+</html>
+`
+
+var (
+	markdown = template.Must(template.New("markdown").Funcs(funcs).Parse(markdownTemplate))
+	html     = htmltemplate.Must(htmltemplate.New("html").Funcs(htmltemplate.FuncMap(funcs)).Parse(htmlTemplate))
+)
+
+// Markdown renders the summary as Markdown.
+func (s Summary) Markdown() string {
+	var buf bytes.Buffer
+	if err := markdown.Execute(&buf, s); err != nil {
+		panic(err) // the template is static
+	}
+	return buf.String()
+}
+
+// HTML renders the summary as HTML page.
+func (s Summary) HTML() string {
+	var buf bytes.Buffer
+	if err := html.Execute(&buf, s); err != nil {
+		panic(err) // the template is static
+	}
+	return buf.String()
+}
@@ -0,0 +1,288 @@
+package report
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"solarizer/energy"
+	"solarizer/kpi"
+	"solarizer/solarweb"
+	"solarizer/statefile"
+	"solarizer/tariff"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/influxdata/influxdb-client-go/v2/api/write"
+)
+
+const (
+	deliverTimeout = 30 * time.Second
+	// retryInterval is the delay before a failed report is compiled again
+	retryInterval = 5 * time.Minute
+	// latestReport is the latest time of day a report is compiled at, the
+	// energy counters of the day are reset at midnight
+	latestReport = 24*time.Hour - 5*time.Minute
+)
+
+var (
+	// ErrNotFound is returned for periods without report.
+	ErrNotFound = errors.New("report not found")
+	// ErrInvalidPeriod is returned for periods that are neither a day nor a month.
+	ErrInvalidPeriod = errors.New("invalid period")
+)
+
+// Config configures when reports are compiled and where they are stored.
+type Config struct {
+	Dir string // reports are stored in the subdirectories daily and monthly
+	// Sun schedules the daily report AfterSunset at the location, otherwise
+	// and during polar day and night it is compiled At the offset from
+	// midnight
+	Sun         bool
+	Latitude    float64
+	Longitude   float64
+	AfterSunset time.Duration
+	At          time.Duration
+}
+
+// peakState is persisted whenever a peak is raised.
+type peakState struct {
+	Day   time.Time `json:"day"`
+	Peaks Peaks     `json:"peaks"`
+}
+
+// Reporter compiles a daily report from the energy counters, the costs and the
+// peak power of the day, and on the last day of a month a monthly roll-up of
+// the stored daily reports. It implements influx.PowerObserver to track the
+// peaks.
+type Reporter struct {
+	config     Config
+	integrator *energy.Integrator
+	costs      *tariff.Calculator // optional
+	deliverers []Deliverer
+
+	mu    sync.Mutex
+	peaks peakState
+
+	retryAt time.Time // a failed report of the day is not compiled again before
+}
+
+// New creates a reporter and restores the peaks of the day from the report
+// directory.
+func New(config Config, integrator *energy.Integrator, costs *tariff.Calculator, deliverers []Deliverer) (*Reporter, error) {
+	r := &Reporter{config: config, integrator: integrator, costs: costs, deliverers: deliverers}
+	if _, err := statefile.Load(r.peaksFilename(), &r.peaks); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// ObservePower raises the peaks of the day. It returns no points.
+func (r *Reporter) ObservePower(now time.Time, data solarweb.CompareData) []*write.Point {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if day := startOfDay(now); !day.Equal(r.peaks.Day) {
+		r.peaks = peakState{Day: day}
+	}
+	before := r.peaks.Peaks
+	r.peaks.Peaks.observe(now, energy.FromSample(data))
+	if r.peaks.Peaks != before {
+		if err := statefile.Save(r.peaksFilename(), &r.peaks); err != nil {
+			log.Error("Unable to persist peaks", "err", err)
+		}
+	}
+	return nil
+}
+
+// Run compiles the reports at the scheduled time until ctx is cancelled. A
+// report missed while solarizer was stopped is compiled at startup, if it is
+// still the same day.
+func (r *Reporter) Run(ctx context.Context) {
+	for {
+		timer := time.NewTimer(time.Until(r.next(time.Now())))
+		select {
+		case <-timer.C:
+			r.attempt(ctx, time.Now())
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		}
+	}
+}
+
+// attempt compiles the report and delays the next attempt if it fails.
+func (r *Reporter) attempt(ctx context.Context, now time.Time) {
+	if err := r.Report(ctx, now); err != nil {
+		r.retryAt = minTime(now.Add(retryInterval), startOfDay(now).Add(latestReport))
+		log.Error("Error compiling report", "err", err, "retry", r.retryAt)
+	}
+}
+
+// Report compiles, stores and delivers the report of the day of now, and of
+// the month on its last day.
+func (r *Reporter) Report(ctx context.Context, now time.Time) error {
+	daily, err := r.Daily(now)
+	if err != nil {
+		return err
+	}
+	if err := r.store("daily", daily); err != nil {
+		return err
+	}
+	log.Info("Compiled daily report", "period", daily.Period)
+	r.deliver(ctx, daily)
+
+	if tomorrow := daily.Start.AddDate(0, 0, 1); tomorrow.Month() != daily.Start.Month() {
+		monthly, err := r.Load(daily.Start.Format("2006-01"))
+		if err != nil {
+			return err
+		}
+		if err := r.store("monthly", monthly); err != nil {
+			return err
+		}
+		log.Info("Compiled monthly report", "period", monthly.Period)
+		r.deliver(ctx, monthly)
+	}
+	return nil
+}
+
+// Daily compiles the summary of the day of now from the current counters.
+func (r *Reporter) Daily(now time.Time) (Summary, error) {
+	day := startOfDay(now)
+	counters := r.integrator.Counters()
+	if !counters.DayStart.Equal(day) {
+		return Summary{}, fmt.Errorf("no power data of %s", day.Format(time.DateOnly))
+	}
+	s := Summary{
+		Period: day.Format(time.DateOnly),
+		Start:  day,
+		End:    day.AddDate(0, 0, 1),
+		Energy: kpi.Compute(counters.Day),
+	}
+	r.mu.Lock()
+	if r.peaks.Day.Equal(day) {
+		s.Peaks = r.peaks.Peaks
+	}
+	r.mu.Unlock()
+	if r.costs != nil {
+		if snapshot := r.costs.Snapshot(); snapshot.Day.Start.Equal(day) {
+			s.Currency, s.Costs = snapshot.Currency, &snapshot.Day.Costs
+		}
+	}
+	return s, nil
+}
+
+// Load returns the stored summary of a day ("2006-01-02") or the roll-up of
+// the stored daily summaries of a month ("2006-01").
+func (r *Reporter) Load(period string) (Summary, error) {
+	if month, err := time.ParseInLocation("2006-01", period, time.Local); err == nil {
+		filenames, err := filepath.Glob(filepath.Join(r.config.Dir, "daily", period+"-[0-3][0-9].json"))
+		if err != nil {
+			return Summary{}, err
+		}
+		if len(filenames) == 0 {
+			return Summary{}, ErrNotFound
+		}
+		slices.Sort(filenames)
+		days := make([]Summary, 0, len(filenames))
+		for _, filename := range filenames {
+			day, err := load(filename)
+			if err != nil {
+				return Summary{}, err
+			}
+			days = append(days, day)
+		}
+		return Monthly(month, days), nil
+	}
+	if _, err := time.Parse(time.DateOnly, period); err != nil {
+		return Summary{}, fmt.Errorf("%w %q, expected YYYY-MM-DD or YYYY-MM", ErrInvalidPeriod, period)
+	}
+	return load(filepath.Join(r.config.Dir, "daily", period+".json"))
+}
+
+// next returns the time the next report is due.
+func (r *Reporter) next(now time.Time) time.Time {
+	due := r.due(now)
+	if now.Before(due) {
+		return due
+	}
+	day := startOfDay(now)
+	if _, err := os.Stat(filepath.Join(r.config.Dir, "daily", day.Format(time.DateOnly)+".json")); errors.Is(err, os.ErrNotExist) && now.Before(day.Add(latestReport)) {
+		if now.Before(r.retryAt) {
+			return r.retryAt
+		}
+		return now
+	}
+	return r.due(day.AddDate(0, 0, 1))
+}
+
+// due returns the scheduled time of the report of the day of t.
+func (r *Reporter) due(t time.Time) time.Time {
+	day := startOfDay(t)
+	at := day.Add(r.config.At)
+	if r.config.Sun {
+		if sunset, ok := Sunset(day, r.config.Latitude, r.config.Longitude); ok {
+			at = sunset.Add(r.config.AfterSunset)
+		}
+	}
+	return minTime(at, day.Add(latestReport))
+}
+
+// store writes the summary as JSON, Markdown and HTML.
+func (r *Reporter) store(kind string, s Summary) error {
+	dir := filepath.Join(r.config.Dir, kind)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	for ext, content := range map[string][]byte{".json": data, ".md": []byte(s.Markdown()), ".html": []byte(s.HTML())} {
+		if err := os.WriteFile(filepath.Join(dir, s.Period+ext), content, 0o644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deliver sends the report to all deliverers, failures are logged.
+func (r *Reporter) deliver(ctx context.Context, s Summary) {
+	for _, deliverer := range r.deliverers {
+		deliverCtx, cancel := context.WithTimeout(ctx, deliverTimeout)
+		if err := deliverer.Deliver(deliverCtx, s); err != nil {
+			log.Error("Error delivering report", "deliverer", deliverer.Name(), "period", s.Period, "err", err)
+		}
+		cancel()
+	}
+}
+
+func (r *Reporter) peaksFilename() string {
+	return filepath.Join(r.config.Dir, "peaks.json")
+}
+
+func load(filename string) (Summary, error) {
+	var s Summary
+	found, err := statefile.Load(filename, &s)
+	if err != nil {
+		return Summary{}, err
+	}
+	if !found {
+		return Summary{}, ErrNotFound
+	}
+	return s, nil
+}
+
+func startOfDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+func minTime(a time.Time, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+	return b
+}
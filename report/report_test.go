@@ -0,0 +1,136 @@
+package report
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"solarizer/energy"
+	"solarizer/influx"
+	"solarizer/solarweb"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSunset(t *testing.T) {
+	vienna, err := time.LoadLocation("Europe/Vienna")
+	if err != nil {
+		t.Skip("time zone database not available")
+	}
+	for _, tc := range []struct {
+		date time.Time
+		want time.Time
+	}{
+		{time.Date(2025, 6, 21, 0, 0, 0, 0, vienna), time.Date(2025, 6, 21, 20, 58, 0, 0, vienna)},
+		{time.Date(2025, 12, 21, 0, 0, 0, 0, vienna), time.Date(2025, 12, 21, 16, 3, 0, 0, vienna)},
+	} {
+		sunset, ok := Sunset(tc.date, 48.21, 16.37)
+		if diff := sunset.Sub(tc.want).Abs(); !ok || diff > 3*time.Minute {
+			t.Errorf("Sunset(%s) = %s, want %s", tc.date.Format(time.DateOnly), sunset, tc.want)
+		}
+	}
+	if _, ok := Sunset(time.Date(2025, 6, 21, 0, 0, 0, 0, time.UTC), 78.2, 15.6); ok {
+		t.Error("Sunset reported a sunset during polar day")
+	}
+}
+
+func TestDailyAndMonthlyReports(t *testing.T) {
+	var delivered []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Period   string `json:"period"`
+			Markdown string `json:"markdown"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		if !strings.Contains(body.Markdown, "# Solar report "+body.Period) {
+			t.Errorf("markdown of %s = %q", body.Period, body.Markdown)
+		}
+		delivered = append(delivered, body.Period)
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	integrator, err := energy.Open("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	reporter, err := New(Config{Dir: dir, At: 21 * time.Hour}, integrator, nil, []Deliverer{NewWebhookDeliverer(server.URL)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 6 kW PV for one minute (100 Wh) on the 29th and 12 kW on the 30th
+	for _, day := range []int{29, 30} {
+		start := time.Date(2025, 6, day, 12, 0, 0, 0, time.Local)
+		for minute := range 2 {
+			sample := solarweb.CompareData{PowerPV: float64(day-28) * 6000, PowerGrid: float64(day-28) * -6000}
+			for _, observer := range []influx.PowerObserver{integrator, reporter} {
+				observer.ObservePower(start.Add(time.Duration(minute)*time.Minute), sample)
+			}
+		}
+		if err := reporter.Report(context.Background(), start.Add(9*time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	daily, err := reporter.Load("2025-06-30")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if daily.Energy.PV != 200 || daily.Peaks.PV.Power != 12000 {
+		t.Fatalf("daily = %+v, want 200 Wh and a peak of 12 kW", daily)
+	}
+	monthly, err := reporter.Load("2025-06")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if monthly.Days != 2 || monthly.Energy.PV != 300 || monthly.Energy.GridExport != 300 || monthly.Peaks.PV.Power != 12000 {
+		t.Fatalf("monthly = %+v, want 2 days with 300 Wh", monthly)
+	}
+	for _, name := range []string{"daily/2025-06-29.html", "daily/2025-06-30.md", "monthly/2025-06.json"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("report %s not stored: %v", name, err)
+		}
+	}
+	if strings.Join(delivered, ",") != "2025-06-29,2025-06-30,2025-06" {
+		t.Fatalf("delivered %v, want both days and the month", delivered)
+	}
+	if _, err := reporter.Load("2025-05"); err != ErrNotFound {
+		t.Fatalf("Load of month without reports returned %v, want ErrNotFound", err)
+	}
+}
+
+func TestNextReport(t *testing.T) {
+	reporter := &Reporter{config: Config{Dir: t.TempDir(), At: 21 * time.Hour}}
+	morning := time.Date(2025, 6, 1, 8, 0, 0, 0, time.Local)
+	if next := reporter.next(morning); !next.Equal(morning.Add(13 * time.Hour)) {
+		t.Errorf("next(08:00) = %s, want 21:00", next)
+	}
+	// A missed report is compiled right away
+	evening := morning.Add(14 * time.Hour)
+	if next := reporter.next(evening); !next.Equal(evening) {
+		t.Errorf("next(22:00) = %s, want now", next)
+	}
+}
+
+func TestRetryFailedReport(t *testing.T) {
+	integrator, err := energy.Open("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	reporter := &Reporter{config: Config{Dir: t.TempDir(), At: 21 * time.Hour}, integrator: integrator}
+	// Without a sample of the day the report fails
+	evening := time.Date(2025, 6, 1, 22, 0, 0, 0, time.Local)
+	reporter.attempt(context.Background(), evening)
+	if next := reporter.next(evening); !next.Equal(evening.Add(retryInterval)) {
+		t.Errorf("next after failure at 22:00 = %s, want 22:05", next)
+	}
+	late := time.Date(2025, 6, 1, 23, 52, 0, 0, time.Local)
+	reporter.attempt(context.Background(), late)
+	if next := reporter.next(late); !next.Equal(late.Add(3 * time.Minute)) {
+		t.Errorf("next after failure at 23:52 = %s, want 23:55", next)
+	}
+}
@@ -0,0 +1,83 @@
+package report
+
+import (
+	"solarizer/energy"
+	"solarizer/kpi"
+	"solarizer/tariff"
+	"time"
+)
+
+// Peak is the highest power of a period.
+type Peak struct {
+	Power float64   `json:"power"` // W
+	Time  time.Time `json:"time"`
+}
+
+// Peaks are the highest powers of a period.
+type Peaks struct {
+	PV         Peak `json:"pv"`
+	Load       Peak `json:"load"`
+	GridImport Peak `json:"grid_import"`
+	GridExport Peak `json:"grid_export"`
+}
+
+// observe raises the peaks to the flows of a sample.
+func (p *Peaks) observe(t time.Time, f energy.Flows) {
+	for _, item := range []struct {
+		peak  *Peak
+		power float64
+	}{{&p.PV, f.PV}, {&p.Load, f.Load}, {&p.GridImport, f.GridImport}, {&p.GridExport, f.GridExport}} {
+		if item.power > item.peak.Power {
+			*item.peak = Peak{Power: item.power, Time: t}
+		}
+	}
+}
+
+// merge raises the peaks to the peaks of another period.
+func (p *Peaks) merge(o Peaks) {
+	p.observe(o.PV.Time, energy.Flows{PV: o.PV.Power})
+	p.observe(o.Load.Time, energy.Flows{Load: o.Load.Power})
+	p.observe(o.GridImport.Time, energy.Flows{GridImport: o.GridImport.Power})
+	p.observe(o.GridExport.Time, energy.Flows{GridExport: o.GridExport.Power})
+}
+
+// Summary of a day or a month.
+type Summary struct {
+	Period   string        `json:"period"` // "2006-01-02" for a day, "2006-01" for a month
+	Start    time.Time     `json:"start"`
+	End      time.Time     `json:"end"`
+	Days     int           `json:"days"` // number of daily summaries of a month
+	Energy   kpi.KPIs      `json:"energy"`
+	Peaks    Peaks         `json:"peaks"`
+	Currency string        `json:"currency,omitempty"`
+	Costs    *tariff.Costs `json:"costs,omitempty"` // nil without tariff
+}
+
+// Monthly rolls the daily summaries of a month up into a monthly summary.
+func Monthly(month time.Time, days []Summary) Summary {
+	start := time.Date(month.Year(), month.Month(), 1, 0, 0, 0, 0, month.Location())
+	s := Summary{
+		Period: start.Format("2006-01"),
+		Start:  start,
+		End:    start.AddDate(0, 1, 0),
+		Days:   len(days),
+	}
+	var flows energy.Flows
+	for _, day := range days {
+		flows = flows.Add(day.Energy.Flows, 1)
+		s.Peaks.merge(day.Peaks)
+		if day.Costs != nil {
+			if s.Costs == nil {
+				s.Costs, s.Currency = &tariff.Costs{}, day.Currency
+			}
+			s.Costs.Import += day.Costs.Import
+			s.Costs.FeedIn += day.Costs.FeedIn
+			s.Costs.BaseFee += day.Costs.BaseFee
+			s.Costs.Net += day.Costs.Net
+			s.Costs.WithoutPV += day.Costs.WithoutPV
+			s.Costs.Savings += day.Costs.Savings
+		}
+	}
+	s.Energy = kpi.Compute(flows)
+	return s
+}
@@ -0,0 +1,48 @@
+package report
+
+import (
+	"math"
+	"time"
+)
+
+// j2000 is the Julian date of 2000-01-01 12:00 UTC.
+const j2000 = 2451545.0
+
+// Sunset returns the sunset of the day of date at the location with the
+// sunrise equation, accurate to a few minutes. It reports false during polar
+// day and night.
+func Sunset(date time.Time, latitude float64, longitude float64) (time.Time, bool) {
+	noon := time.Date(date.Year(), date.Month(), date.Day(), 12, 0, 0, 0, time.UTC)
+	n := math.Round(julianDate(noon) - j2000 + 0.0008)
+
+	meanSolarNoon := n - longitude/360
+	anomaly := math.Mod(357.5291+0.98560028*meanSolarNoon, 360)
+	center := 1.9148*sin(anomaly) + 0.02*sin(2*anomaly) + 0.0003*sin(3*anomaly)
+	eclipticLongitude := math.Mod(anomaly+center+180+102.9372, 360)
+	transit := j2000 + meanSolarNoon + 0.0053*sin(anomaly) - 0.0069*sin(2*eclipticLongitude)
+
+	sinDeclination := sin(eclipticLongitude) * sin(23.4397)
+	cosDeclination := math.Cos(math.Asin(sinDeclination))
+	cosHourAngle := (sin(-0.833) - sin(latitude)*sinDeclination) / (cos(latitude) * cosDeclination)
+	if cosHourAngle < -1 || cosHourAngle > 1 {
+		return time.Time{}, false
+	}
+	hourAngle := math.Acos(cosHourAngle) * 180 / math.Pi
+	return fromJulianDate(transit + hourAngle/360).In(date.Location()), true
+}
+
+func julianDate(t time.Time) float64 {
+	return float64(t.UnixMilli())/86400000 + 2440587.5
+}
+
+func fromJulianDate(jd float64) time.Time {
+	return time.UnixMilli(int64(math.Round((jd - 2440587.5) * 86400000)))
+}
+
+func sin(degrees float64) float64 {
+	return math.Sin(degrees * math.Pi / 180)
+}
+
+func cos(degrees float64) float64 {
+	return math.Cos(degrees * math.Pi / 180)
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"solarizer/anomaly"
+	"solarizer/apiserver"
+	"solarizer/availability"
+	"solarizer/battery"
+	"solarizer/energy"
+	"solarizer/forecast"
+	"solarizer/history"
+	"solarizer/influx"
+	"solarizer/kpi"
+	"solarizer/loadcontrol"
+	"solarizer/report"
+	"solarizer/solarweb"
+	"solarizer/tariff"
+	"syscall"
+	"time"
+
+	"github.com/charmbracelet/log"
+)
+
+// runServe starts the long-running API server and Influx importer and blocks
+// until SIGTERM or SIGINT is received.
+func runServe() {
+	log.Info("Starting up")
+
+	// Initialize SolarWeb client
+	solarWebClient := newSolarWebClient()
+
+	// Create importer
+	var importer *influx.Importer
+	backends := apiserver.Backends{}
+	if os.Getenv("DISABLE_INFLUX_IMPORTER") == "true" {
+		log.Info("Influx importer disabled")
+	} else {
+		sinks, historyStore := newSinks()
+		importer = influx.NewImporter(solarWebClient, sinks...)
+		backends.Importer = importer
+		addPowerObservers(importer, solarWebClient, &backends)
+		if backends.Alerts = alertConfig(solarWebClient.Status, backends.Anomalies, getenvDurationDefault("STALE_DATA_AFTER", 15*time.Minute)); backends.Alerts != nil {
+			importer.AddPowerObserver(backends.Alerts)
+			log.Info("Alerting enabled")
+		}
+		if historyStore != nil {
+			backends.History = historyStore
+		}
+		log.Info("Influx importer initialized")
+	}
+	if backends.History == nil && os.Getenv("INFLUX_URL") != "" {
+		// Without local history database, history queries are sent to Influx
+		influxSource := history.NewInfluxSource(influxConfig())
+		defer influxSource.Close()
+		backends.History = influxSource
+	}
+	if system, days, ok := forecastConfig(); ok {
+		backends.Forecast = forecast.New(system, backends.History, days)
+		if importer != nil {
+			importer.AddPowerObserver(backends.Forecast)
+		}
+		log.Info("Forecast enabled", "peak_power", system.PeakPower)
+	}
+
+	// Create api
+	var api *apiserver.ApiServer
+	if os.Getenv("DISABLE_API_SERVER") == "true" {
+		log.Info("API server disabled")
+	} else {
+		api = apiserver.New(apiServerAddr, solarWebClient, backends)
+		log.Info("API server initialized", "addr", apiServerAddr)
+	}
+
+	// Create a channel to capture SIGTERM, SIGINT
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGTERM, syscall.SIGINT)
+	// Create a context listening to SIGTERM, SIGINT
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer stop()
+
+	// Run tasks asynchronously
+	if api != nil {
+		go api.ListenAndServe()
+	}
+	if importer != nil {
+		go importer.RunImportLoop(ctx)
+	}
+	if backends.Prices != nil {
+		go backends.Prices.Run(ctx)
+	}
+	if backends.Alerts != nil {
+		go backends.Alerts.Run(ctx)
+	}
+	if backends.Anomalies != nil {
+		go backends.Anomalies.Run(ctx)
+	}
+	if backends.Reports != nil {
+		go backends.Reports.Run(ctx)
+	}
+	if backends.Forecast != nil {
+		go backends.Forecast.Run(ctx)
+	}
+	if backends.Loads != nil {
+		go backends.Loads.Run(ctx)
+	}
+
+	// Block and wait for signal
+	sig := <-quit
+	log.Info("Shutting down", "signal", sig)
+
+	// Shutdown api server and importer
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if api != nil {
+		if err := api.Shutdown(shutdownCtx); err != nil {
+			log.Error("Shutdown of API server failed", "err", err)
+		}
+	}
+	if importer != nil {
+		if err := importer.Shutdown(shutdownCtx); err != nil {
+			log.Error("Shutdown of importer failed", "err", err)
+		}
+	}
+	if backends.Alerts != nil {
+		backends.Alerts.Close()
+	}
+	if backends.Loads != nil {
+		backends.Loads.Close()
+	}
+
+	log.Info("Shutdown complete")
+}
+
+// addPowerObservers registers the modules deriving data from the power
+// samples with the importer and exposes them in the API. The energy counters
+// are used by the other modules, so the integrator comes first.
+func addPowerObservers(importer *influx.Importer, solarWebClient *solarweb.SolarWeb, backends *apiserver.Backends) {
+	integrator, err := energy.Open(getenvDefault("ENERGY_STATE_FILE", "/tmp/solarizer/energy.json"))
+	if err != nil {
+		log.Fatal("Unable to restore energy counters", "err", err)
+	}
+	importer.AddPowerObserver(integrator)
+	backends.Energy = integrator
+
+	backends.KPI = kpi.NewTracker(integrator)
+	importer.AddPowerObserver(backends.KPI)
+
+	// Systems without battery report no battery power and a state of charge of 0
+	if os.Getenv("BATTERY_CAPACITY") != "" {
+		backends.Battery, err = battery.NewTracker(getenvFloat("BATTERY_CAPACITY"), integrator,
+			getenvDefault("BATTERY_STATE_FILE", "/tmp/solarizer/battery.json"))
+		if err != nil {
+			log.Fatal("Unable to restore battery statistics", "err", err)
+		}
+		importer.AddPowerObserver(backends.Battery)
+		log.Info("Battery statistics enabled", "capacity", getenvFloat("BATTERY_CAPACITY"))
+	}
+
+	var weather *solarweb.SolarWeb
+	if os.Getenv("ANOMALY_WEATHER") != "false" {
+		weather = solarWebClient
+	}
+	backends.Anomalies, err = anomaly.NewDetector(getenvFloatDefault("ANOMALY_THRESHOLD", 0.6), integrator, weather,
+		getenvDefault("ANOMALY_STATE_FILE", "/tmp/solarizer/anomaly.json"))
+	if err != nil {
+		log.Fatal("Unable to restore production history", "err", err)
+	}
+	importer.AddPowerObserver(backends.Anomalies)
+
+	backends.Availability, err = availability.NewTracker(getenvDurationDefault("STALE_DATA_AFTER", 15*time.Minute),
+		getenvDefault("AVAILABILITY_STATE_FILE", "/tmp/solarizer/availability.json"))
+	if err != nil {
+		log.Fatal("Unable to restore outages", "err", err)
+	}
+	importer.AddPowerObserver(backends.Availability)
+
+	var calculator *tariff.Calculator
+	if t, ok := tariffConfig(); ok {
+		calculator, err = tariff.NewCalculator(t, integrator, getenvDefault("COSTS_STATE_FILE", "/tmp/solarizer/costs.json"))
+		if err != nil {
+			log.Fatal("Unable to restore costs", "err", err)
+		}
+		importer.AddPowerObserver(calculator)
+		backends.Costs = calculator
+		backends.Prices = t.Prices
+		log.Info("Cost calculation enabled", "currency", t.Currency)
+	}
+
+	if filename := os.Getenv("LOAD_CONTROL_CONFIG"); filename != "" {
+		loads, err := loadcontrol.LoadConfig(filename)
+		if err != nil {
+			log.Fatal("Unable to load load control config", "err", err)
+		}
+		dryRun := os.Getenv("LOAD_CONTROL_DRY_RUN") == "true"
+		backends.Loads = loadcontrol.NewController(loads, dryRun, getenvDurationDefault("STALE_DATA_AFTER", 15*time.Minute))
+		importer.AddPowerObserver(backends.Loads)
+		log.Info("Load control enabled", "loads", len(loads), "dry_run", dryRun)
+	}
+
+	if config, deliverers, ok := reportConfig(); ok {
+		backends.Reports, err = report.New(config, integrator, calculator, deliverers)
+		if err != nil {
+			log.Fatal("Unable to restore peaks", "err", err)
+		}
+		importer.AddPowerObserver(backends.Reports)
+		log.Info("Reports enabled", "dir", config.Dir)
+	}
+}
@@ -0,0 +1,44 @@
+package solarweb
+
+// batteryModes are the names of the battery mode codes reported by Fronius
+// inverters in BatMode.
+var batteryModes = map[int]string{
+	0:  "disabled",
+	1:  "normal",
+	2:  "service",
+	3:  "charge_boost",
+	4:  "nearly_depleted",
+	5:  "suspended",
+	6:  "calibrating",
+	7:  "grid_support",
+	8:  "deplete_recovery",
+	9:  "non_operable_voltage",
+	10: "non_operable_temperature",
+	11: "preheating",
+	12: "startup",
+	13: "stopped_temperature",
+	14: "battery_full",
+}
+
+// BatteryModeName returns the name of a battery mode code, "unknown" for codes
+// without name.
+func BatteryModeName(code float64) string {
+	if code != float64(int(code)) {
+		return "unknown"
+	}
+	if name, ok := batteryModes[int(code)]; ok {
+		return name
+	}
+	return "unknown"
+}
+
+// batteryState returns the name of the battery mode of the sample. A battery
+// in normal mode that neither charges nor discharges although it is not full,
+// e.g. while held by a charge or discharge limit, is in state "hold", which has
+// no mode code of its own.
+func batteryState(data CompareData) string {
+	if data.BatteryMode == 1 && data.PowerBattery == 0 && data.BatteryPercentage < 100 {
+		return "hold"
+	}
+	return BatteryModeName(data.BatteryMode)
+}
@@ -0,0 +1,39 @@
+package solarweb
+
+import (
+	"testing"
+)
+
+func TestBatteryModeName(t *testing.T) {
+	for code, want := range map[float64]string{
+		0:   "disabled",
+		1:   "normal",
+		6:   "calibrating",
+		14:  "battery_full",
+		15:  "unknown",
+		1.5: "unknown",
+		-1:  "unknown",
+		99:  "unknown",
+	} {
+		if got := BatteryModeName(code); got != want {
+			t.Errorf("BatteryModeName(%g) = %q, want %q", code, got, want)
+		}
+	}
+}
+
+func TestBatteryState(t *testing.T) {
+	for _, test := range []struct {
+		data CompareData
+		want string
+	}{
+		{CompareData{BatteryMode: 1, PowerBattery: -1200, BatteryPercentage: 60}, "normal"},
+		{CompareData{BatteryMode: 1, PowerBattery: 0, BatteryPercentage: 60}, "hold"},
+		{CompareData{BatteryMode: 1, PowerBattery: 0, BatteryPercentage: 100}, "normal"},
+		{CompareData{BatteryMode: 14, PowerBattery: 0, BatteryPercentage: 100}, "battery_full"},
+		{CompareData{BatteryMode: 5, PowerBattery: 0, BatteryPercentage: 60}, "suspended"},
+	} {
+		if got := batteryState(test.data); got != test.want {
+			t.Errorf("batteryState(%+v) = %q, want %q", test.data, got, test.want)
+		}
+	}
+}
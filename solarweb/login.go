@@ -48,6 +48,12 @@ func (s *SolarWeb) login() error {
 	s.loginMu.Lock()
 	defer s.loginMu.Unlock()
 
+	err := s.doLogin()
+	s.recordLogin(err)
+	return err
+}
+
+func (s *SolarWeb) doLogin() error {
 	log.Info("Logging into SolarWeb using credentials")
 
 	externalLoginResp, err := s.newRequest(http.MethodGet, baseURL+"/Account/ExternalLogin", nil)
@@ -0,0 +1,76 @@
+package solarweb
+
+// Directions of the grid and battery flows.
+const (
+	DirectionIdle        = "idle"
+	DirectionImport      = "import"
+	DirectionExport      = "export"
+	DirectionCharging    = "charging"
+	DirectionDischarging = "discharging"
+)
+
+// PowerFlow is a sample normalized to non-negative flows in W. Of each pair
+// of opposite flows, at most one is non-zero, the direction names it.
+type PowerFlow struct {
+	Production       float64 `json:"production"`  // PV
+	Consumption      float64 `json:"consumption"` // house load
+	GridImport       float64 `json:"grid_import"`
+	GridExport       float64 `json:"grid_export"`
+	GridDirection    string  `json:"grid_direction"`
+	BatteryCharge    float64 `json:"battery_charge"`
+	BatteryDischarge float64 `json:"battery_discharge"`
+	BatteryDirection string  `json:"battery_direction"`
+	BatterySOC       float64 `json:"battery_soc"` // in %
+}
+
+// Flow normalizes the signed powers reported by SolarWeb: the grid power is
+// positive when importing, the load is negative and the battery power is
+// positive when discharging.
+func (d CompareData) Flow() PowerFlow {
+	f := PowerFlow{
+		Production:       max(d.PowerPV, 0),
+		Consumption:      max(-d.PowerLoad, 0),
+		GridImport:       max(d.PowerGrid, 0),
+		GridExport:       max(-d.PowerGrid, 0),
+		GridDirection:    DirectionIdle,
+		BatteryCharge:    max(-d.PowerBattery, 0),
+		BatteryDischarge: max(d.PowerBattery, 0),
+		BatteryDirection: DirectionIdle,
+		BatterySOC:       d.BatteryPercentage,
+	}
+	switch {
+	case f.GridImport > 0:
+		f.GridDirection = DirectionImport
+	case f.GridExport > 0:
+		f.GridDirection = DirectionExport
+	}
+	switch {
+	case f.BatteryCharge > 0:
+		f.BatteryDirection = DirectionCharging
+	case f.BatteryDischarge > 0:
+		f.BatteryDirection = DirectionDischarging
+	}
+	return f
+}
+
+// GridPower returns the net grid power, positive when importing.
+func (f PowerFlow) GridPower() float64 {
+	return f.GridImport - f.GridExport
+}
+
+// BatteryPower returns the net battery power, positive when discharging.
+func (f PowerFlow) BatteryPower() float64 {
+	return f.BatteryDischarge - f.BatteryCharge
+}
+
+// PowerData is a sample together with its normalized flow, as returned by the
+// API.
+type PowerData struct {
+	CompareData
+	Flow PowerFlow `json:"Flow"`
+}
+
+// NewPowerData adds the normalized flow to a sample.
+func NewPowerData(d CompareData) PowerData {
+	return PowerData{CompareData: d, Flow: d.Flow()}
+}
@@ -0,0 +1,63 @@
+package solarweb
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestFlow(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		data CompareData
+		want PowerFlow
+	}{
+		{
+			name: "export and charge",
+			data: CompareData{PowerPV: 5000, PowerLoad: -800, PowerGrid: -3200, PowerBattery: -1000, BatteryPercentage: 60},
+			want: PowerFlow{Production: 5000, Consumption: 800, GridExport: 3200, GridDirection: DirectionExport,
+				BatteryCharge: 1000, BatteryDirection: DirectionCharging, BatterySOC: 60},
+		},
+		{
+			name: "import and discharge",
+			data: CompareData{PowerLoad: -1500, PowerGrid: 300, PowerBattery: 1200, BatteryPercentage: 40},
+			want: PowerFlow{Consumption: 1500, GridImport: 300, GridDirection: DirectionImport,
+				BatteryDischarge: 1200, BatteryDirection: DirectionDischarging, BatterySOC: 40},
+		},
+		{
+			name: "idle",
+			data: CompareData{PowerPV: -2},
+			want: PowerFlow{GridDirection: DirectionIdle, BatteryDirection: DirectionIdle},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.data.Flow()
+			if got != tt.want {
+				t.Errorf("Flow() = %+v, want %+v", got, tt.want)
+			}
+			if got.GridPower() != tt.data.PowerGrid {
+				t.Errorf("GridPower() = %g, want %g", got.GridPower(), tt.data.PowerGrid)
+			}
+			if got.BatteryPower() != tt.data.PowerBattery {
+				t.Errorf("BatteryPower() = %g, want %g", got.BatteryPower(), tt.data.PowerBattery)
+			}
+		})
+	}
+}
+
+func TestPowerDataJSON(t *testing.T) {
+	b, err := json.Marshal(NewPowerData(CompareData{PowerGrid: 100}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m map[string]any
+	if err := json.Unmarshal(b, &m); err != nil {
+		t.Fatal(err)
+	}
+	if m["P_Grid"] != 100.0 {
+		t.Errorf("P_Grid = %v, want 100", m["P_Grid"])
+	}
+	flow, _ := m["Flow"].(map[string]any)
+	if flow["grid_import"] != 100.0 || flow["grid_direction"] != DirectionImport {
+		t.Errorf("Flow = %v, want an import of 100", flow)
+	}
+}
@@ -1,6 +1,7 @@
 package solarweb
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -17,6 +18,7 @@ import (
 
 // Endpoints:
 // /ActualData/GetCompareDataForPvSystem?pvSystemId={pvSystemId}
+// /Chart/GetChartNew?pvSystemId={pvSystemId}&year={year}&month={month}&day={day}&interval=day&view=production
 // /Chart/GetWidgetChart?PvSystemId={pvSystemId}
 // /Messages/GetUnreadMessageCountForUser
 // /Messages/GetUnreadMessages
@@ -43,6 +45,8 @@ type SolarWeb struct {
 	cb         *gobreaker.CircuitBreaker[*http.Response]
 	client     *http.Client
 	loginMu    sync.Mutex
+	statusMu   sync.Mutex
+	status     Status
 }
 
 func New(pvSystemId string, authCookieFilename string, username string, password string) *SolarWeb {
@@ -59,7 +63,8 @@ func New(pvSystemId string, authCookieFilename string, username string, password
 			return counts.Requests >= 3 && failureRatio >= 0.6
 		},
 		IsExcluded: func(err error) bool {
-			return errors.Is(err, errAuthenticationRequired)
+			// Cancelled requests say nothing about the health of SolarWeb
+			return errors.Is(err, errAuthenticationRequired) || errors.Is(err, context.Canceled)
 		},
 	}
 	cb := gobreaker.NewCircuitBreaker[*http.Response](cbSettings)
@@ -82,8 +87,31 @@ func (s *SolarWeb) SetAuthCookie(value string) {
 	s.jar.ResetAuthCookie(value)
 }
 
-func (s *SolarWeb) get(path string) (*http.Response, error) {
-	resp, err := s.doGet(path)
+// AuthCookie returns the current value of the auth cookie or an empty string
+// if no cookie is known.
+func (s *SolarWeb) AuthCookie() string {
+	for _, cookie := range s.jar.Cookies(cookieURL) {
+		if cookie.Name == authCookieName {
+			return cookie.Value
+		}
+	}
+	return ""
+}
+
+// Login runs the Fronius login flow with the configured credentials. The
+// refreshed auth cookie is persisted by the cookie jar.
+func (s *SolarWeb) Login() error {
+	return s.login()
+}
+
+func (s *SolarWeb) get(ctx context.Context, path string) (*http.Response, error) {
+	resp, err := s.getWithLogin(ctx, path)
+	s.recordRequest(err)
+	return resp, err
+}
+
+func (s *SolarWeb) getWithLogin(ctx context.Context, path string) (*http.Response, error) {
+	resp, err := s.doGet(ctx, path)
 	if err == nil {
 		return resp, nil
 	}
@@ -97,31 +125,17 @@ func (s *SolarWeb) get(path string) (*http.Response, error) {
 		return nil, fmt.Errorf("%w: automatic re-login failed: %w", err, loginErr)
 	}
 
-	return s.doGet(path)
+	return s.doGet(ctx, path)
 }
 
-func (s *SolarWeb) doGet(path string) (*http.Response, error) {
-	req, err := http.NewRequest(http.MethodGet, baseURL+path, nil)
+func (s *SolarWeb) doGet(ctx context.Context, path string) (*http.Response, error) {
+	req, err := newRequest(ctx, path)
 	if err != nil {
 		return nil, err
 	}
-	req.Header.Set("Accept", "application/json")
-	req.Header.Set("User-Agent", userAgent)
 
 	resp, err := s.cb.Execute(func() (*http.Response, error) {
-		resp, httpErr := s.client.Do(req)
-		if httpErr != nil {
-			return nil, httpErr
-		}
-		if s.isAuthenticationRequired(resp) {
-			_ = resp.Body.Close()
-			return nil, errAuthenticationRequired
-		}
-		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-			_ = resp.Body.Close()
-			return nil, fmt.Errorf("received non successful status code %s", resp.Status)
-		}
-		return resp, nil
+		return s.do(req)
 	})
 
 	if err != nil {
@@ -131,6 +145,43 @@ func (s *SolarWeb) doGet(path string) (*http.Response, error) {
 	return resp, err
 }
 
+// getAuxiliary requests data not needed for the import, e.g. the weather.
+// Failures neither trip the circuit breaker nor show up in the status, and an
+// expired session is left to the next regular request.
+func (s *SolarWeb) getAuxiliary(ctx context.Context, path string) (*http.Response, error) {
+	req, err := newRequest(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	return s.do(req)
+}
+
+func newRequest(ctx context.Context, path string) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, baseURL+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", userAgent)
+	return req, nil
+}
+
+func (s *SolarWeb) do(req *http.Request) (*http.Response, error) {
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if s.isAuthenticationRequired(resp) {
+		_ = resp.Body.Close()
+		return nil, errAuthenticationRequired
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		_ = resp.Body.Close()
+		return nil, fmt.Errorf("received non successful status code %s", resp.Status)
+	}
+	return resp, nil
+}
+
 func (s *SolarWeb) isAuthenticationRequired(resp *http.Response) bool {
 	if resp == nil || resp.Request == nil || resp.Request.URL == nil {
 		return false
@@ -149,23 +200,24 @@ func (s *SolarWeb) isAuthenticationRequired(resp *http.Response) bool {
 	return strings.Contains(contentType, "text/html")
 }
 
-func (s *SolarWeb) GetCompareData() (CompareData, error) {
+func (s *SolarWeb) GetCompareData(ctx context.Context) (CompareData, error) {
 	var data CompareData
 
-	resp, err := s.get("/ActualData/GetCompareDataForPvSystem?pvSystemId=" + s.pvSystemId)
+	resp, err := s.get(ctx, "/ActualData/GetCompareDataForPvSystem?pvSystemId="+s.pvSystemId)
 	if err != nil {
 		return data, err
 	}
 	defer resp.Body.Close()
 
 	err = json.NewDecoder(resp.Body).Decode(&data)
+	data.BatteryModeName = batteryState(data)
 	return data, err
 }
 
-func (s *SolarWeb) GetProductionsAndEarnings() (ProductionsAndEarnings, error) {
+func (s *SolarWeb) GetProductionsAndEarnings(ctx context.Context) (ProductionsAndEarnings, error) {
 	var data ProductionsAndEarnings
 
-	resp, err := s.get("/PvSystems/GetPvSystemProductionsAndEarnings?pvSystemId=" + s.pvSystemId)
+	resp, err := s.get(ctx, "/PvSystems/GetPvSystemProductionsAndEarnings?pvSystemId="+s.pvSystemId)
 	if err != nil {
 		return data, err
 	}
@@ -175,10 +227,43 @@ func (s *SolarWeb) GetProductionsAndEarnings() (ProductionsAndEarnings, error) {
 	return data, err
 }
 
-func (s *SolarWeb) GetWidgetChart() (WidgetChart, error) {
+func (s *SolarWeb) GetWidgetChart(ctx context.Context) (WidgetChart, error) {
 	var data WidgetChart
 
-	resp, err := s.get("/Chart/GetWidgetChart?PvSystemId=" + s.pvSystemId)
+	resp, err := s.get(ctx, "/Chart/GetWidgetChart?PvSystemId="+s.pvSystemId)
+	if err != nil {
+		return data, err
+	}
+	defer resp.Body.Close()
+
+	err = json.NewDecoder(resp.Body).Decode(&data)
+	return data, err
+}
+
+// GetDayChart returns the production chart of a single day. The series have the
+// same structure as those of GetWidgetChart.
+func (s *SolarWeb) GetDayChart(ctx context.Context, day time.Time) (WidgetChart, error) {
+	var data WidgetChart
+
+	path := fmt.Sprintf("/Chart/GetChartNew?pvSystemId=%s&year=%d&month=%d&day=%d&interval=day&view=production",
+		s.pvSystemId, day.Year(), int(day.Month()), day.Day())
+	resp, err := s.get(ctx, path)
+	if err != nil {
+		return data, err
+	}
+	defer resp.Body.Close()
+
+	err = json.NewDecoder(resp.Body).Decode(&data)
+	return data, err
+}
+
+// GetWeatherWidgetData returns the data of the weather widget. Its structure
+// is undocumented, use WeatherWidget.Condition to interpret it. The request
+// does not affect the circuit breaker and the status.
+func (s *SolarWeb) GetWeatherWidgetData(ctx context.Context) (WeatherWidget, error) {
+	var data WeatherWidget
+
+	resp, err := s.getAuxiliary(ctx, "/PvSystems/GetWeatherWidgetData?pvSystemId="+s.pvSystemId)
 	if err != nil {
 		return data, err
 	}
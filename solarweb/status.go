@@ -0,0 +1,66 @@
+package solarweb
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// Status describes the health of the connection to SolarWeb.
+type Status struct {
+	CircuitState       string    `json:"circuit_state"`
+	HasAuthCookie      bool      `json:"has_auth_cookie"`
+	LastSuccess        time.Time `json:"last_success"`
+	LastError          string    `json:"last_error,omitempty"`
+	LastErrorTime      time.Time `json:"last_error_time"`
+	LastLogin          time.Time `json:"last_login"`
+	LastLoginError     string    `json:"last_login_error,omitempty"`
+	LastLoginErrorTime time.Time `json:"last_login_error_time"`
+	LoginFailures      int       `json:"login_failures"` // consecutive failed logins
+}
+
+// Healthy reports whether the most recent SolarWeb request succeeded and the
+// circuit breaker is not open. Without any request yet, e.g. with the
+// importer disabled, SolarWeb is assumed to be healthy.
+func (st Status) Healthy() bool {
+	return st.CircuitState != "open" && !st.LastErrorTime.After(st.LastSuccess)
+}
+
+// Status returns a snapshot of the connection health.
+func (s *SolarWeb) Status() Status {
+	s.statusMu.Lock()
+	st := s.status
+	s.statusMu.Unlock()
+	st.CircuitState = s.cb.State().String()
+	st.HasAuthCookie = s.AuthCookie() != ""
+	return st
+}
+
+// recordRequest records the outcome of a request. Cancelled requests, e.g. at
+// shutdown, say nothing about the health of SolarWeb.
+func (s *SolarWeb) recordRequest(err error) {
+	if errors.Is(err, context.Canceled) {
+		return
+	}
+	s.statusMu.Lock()
+	defer s.statusMu.Unlock()
+	if err != nil {
+		s.status.LastError = err.Error()
+		s.status.LastErrorTime = time.Now()
+	} else {
+		s.status.LastSuccess = time.Now()
+	}
+}
+
+func (s *SolarWeb) recordLogin(err error) {
+	s.statusMu.Lock()
+	defer s.statusMu.Unlock()
+	if err != nil {
+		s.status.LastLoginError = err.Error()
+		s.status.LastLoginErrorTime = time.Now()
+		s.status.LoginFailures++
+	} else {
+		s.status.LastLogin = time.Now()
+		s.status.LoginFailures = 0
+	}
+}
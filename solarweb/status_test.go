@@ -0,0 +1,28 @@
+package solarweb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+)
+
+func TestStatusHealthy(t *testing.T) {
+	s := New("1", filepath.Join(t.TempDir(), "authcookie"), "user", "password")
+	if st := s.Status(); !st.Healthy() {
+		t.Fatalf("status without requests = %+v, want healthy", st)
+	}
+	s.recordRequest(fmt.Errorf("fetch: %w", context.Canceled))
+	if st := s.Status(); !st.Healthy() || st.LastError != "" {
+		t.Fatalf("status after cancelled request = %+v, want healthy", st)
+	}
+	s.recordRequest(errors.New("timeout"))
+	if st := s.Status(); st.Healthy() {
+		t.Fatalf("status after failed request = %+v, want unhealthy", st)
+	}
+	s.recordRequest(nil)
+	if st := s.Status(); !st.Healthy() {
+		t.Fatalf("status after successful request = %+v, want healthy", st)
+	}
+}
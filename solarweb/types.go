@@ -2,15 +2,18 @@ package solarweb
 
 import "encoding/json"
 
+// CompareData is a power sample in the signed conventions of SolarWeb, use
+// Flow for the normalized flows.
 type CompareData struct {
 	IsOnline          bool    `json:"IsOnline"`
 	AllOnline         bool    `json:"AllOnline"`
-	PowerGrid         float64 `json:"P_Grid"` // Watts from Grid to Inverter
-	PowerLoad         float64 `json:"P_Load"` // Watts from House to Inverter
+	PowerGrid         float64 `json:"P_Grid"` // Watts from Grid to Inverter, positive when importing
+	PowerLoad         float64 `json:"P_Load"` // Watts from House to Inverter, negative when consuming
 	PowerPV           float64 `json:"P_PV"`   // Watts from Cells to Inverter
-	PowerBattery      float64 `json:"P_Batt"` // Watts from Battery to Inverter
+	PowerBattery      float64 `json:"P_Batt"` // Watts from Battery to Inverter, positive when discharging
 	BatteryPercentage float64 `json:"SOC"`    // SOC = State Of Charge
 	BatteryMode       float64 `json:"BatMode"`
+	BatteryModeName   string  `json:"BatModeName"` // decoded from BatteryMode by the client, or "hold"
 	//OhmPilots         []any   `json:"Ohmpilots"`
 	//WattPilots        []any   `json:"Wattpilots"` // probably has a field Power float64 `json:"P"`
 	//Consumers         []any   `json:"Consumers"`
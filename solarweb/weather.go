@@ -0,0 +1,56 @@
+package solarweb
+
+import (
+	"slices"
+	"strings"
+)
+
+// WeatherWidget is the undecoded JSON object of the weather widget.
+type WeatherWidget map[string]any
+
+// conditionKeys are the parts of key names that hold the weather condition,
+// in order of preference.
+var conditionKeys = []string{"condition", "icon", "description", "weather"}
+
+// Condition returns the current weather condition, the first non-empty string
+// value of a key containing "condition", "icon", "description" or "weather"
+// (in that order), searched in nested objects too. It returns "" if there is
+// none. Icon values like "icons/partly-cloudy.svg" are reduced to their base
+// name.
+func (w WeatherWidget) Condition() string {
+	for _, part := range conditionKeys {
+		if value := findString(w, part); value != "" {
+			if i := strings.LastIndexAny(value, "/\\"); i >= 0 {
+				value = value[i+1:]
+			}
+			if i := strings.LastIndex(value, "."); i > 0 {
+				value = value[:i]
+			}
+			return strings.ToLower(value)
+		}
+	}
+	return ""
+}
+
+// findString searches the object breadth-first in sorted key order, so the
+// result is deterministic.
+func findString(object map[string]any, part string) string {
+	keys := make([]string, 0, len(object))
+	for key := range object {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	for _, key := range keys {
+		if value, ok := object[key].(string); ok && value != "" && strings.Contains(strings.ToLower(key), part) {
+			return value
+		}
+	}
+	for _, key := range keys {
+		if nested, ok := object[key].(map[string]any); ok {
+			if value := findString(nested, part); value != "" {
+				return value
+			}
+		}
+	}
+	return ""
+}
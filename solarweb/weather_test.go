@@ -0,0 +1,22 @@
+package solarweb
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestWeatherCondition(t *testing.T) {
+	for body, want := range map[string]string{
+		`{"Temperature": 21.5, "WeatherIcon": "/Content/images/weather/partly-cloudy.png"}`: "partly-cloudy",
+		`{"current": {"description": "Sunny", "icon": "01d"}}`:                              "01d",
+		`{"Temperature": 21.5}`: "",
+	} {
+		var widget WeatherWidget
+		if err := json.Unmarshal([]byte(body), &widget); err != nil {
+			t.Fatal(err)
+		}
+		if got := widget.Condition(); got != want {
+			t.Errorf("Condition of %s = %q, want %q", body, got, want)
+		}
+	}
+}
@@ -0,0 +1,304 @@
+package spool
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/charmbracelet/log"
+)
+
+// A spool directory contains numbered segment files. Records are appended to
+// the newest segment, each record is framed by its length and CRC32 checksum:
+//
+//	[4 byte length][4 byte CRC32][payload]
+//
+// Segments are replayed oldest first and deleted once all their records were
+// handled. A torn or corrupt record ends the replay of its segment, records
+// before it are still delivered.
+
+const (
+	segmentSuffix      = ".seg"
+	headerSize         = 8
+	defaultSegmentSize = 1 << 20
+)
+
+var ErrClosed = errors.New("spool closed")
+
+type Spool struct {
+	dir         string
+	maxBytes    int64
+	segmentSize int64
+
+	mu      sync.Mutex
+	closed  bool
+	current *os.File // segment records are appended to, nil until first append
+	next    uint64   // number of the next segment
+	size    int64    // total size of all segments
+}
+
+// Open opens or creates the spool in dir. If maxBytes is positive, the oldest
+// segments are dropped whenever the spool would grow larger.
+func Open(dir string, maxBytes int64) (*Spool, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	s := &Spool{
+		dir:         dir,
+		maxBytes:    maxBytes,
+		segmentSize: defaultSegmentSize,
+	}
+	segments, err := s.segments()
+	if err != nil {
+		return nil, err
+	}
+	for _, segment := range segments {
+		info, err := os.Stat(s.path(segment))
+		if err != nil {
+			return nil, err
+		}
+		s.size += info.Size()
+		s.next = segment + 1
+	}
+	return s, nil
+}
+
+// Append durably adds one record to the spool.
+func (s *Spool) Append(record []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return ErrClosed
+	}
+
+	recordSize := int64(headerSize + len(record))
+	if err := s.makeRoom(recordSize); err != nil {
+		return err
+	}
+	if s.current == nil {
+		if err := s.openSegment(); err != nil {
+			return err
+		}
+	}
+
+	buf := make([]byte, headerSize, recordSize)
+	binary.BigEndian.PutUint32(buf[0:4], uint32(len(record)))
+	binary.BigEndian.PutUint32(buf[4:8], crc32.ChecksumIEEE(record))
+	buf = append(buf, record...)
+	if _, err := s.current.Write(buf); err != nil {
+		return err
+	}
+	if err := s.current.Sync(); err != nil {
+		return err
+	}
+	s.size += recordSize
+
+	if info, err := s.current.Stat(); err == nil && info.Size() >= s.segmentSize {
+		return s.sealSegment()
+	}
+	return nil
+}
+
+// Replay calls handle for every record, oldest first. A segment is deleted
+// after all its records were handled successfully. Replay stops at the first
+// error returned by handle, the records of the current segment are then
+// delivered again by the next replay.
+func (s *Spool) Replay(handle func(record []byte) error) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return ErrClosed
+	}
+	// Seal the segment in use so appends during the replay go to a new one
+	if err := s.sealSegment(); err != nil {
+		s.mu.Unlock()
+		return err
+	}
+	segments, err := s.segments()
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	for _, segment := range segments {
+		if err := s.replaySegment(segment, handle); err != nil {
+			return err
+		}
+		if err := s.removeSegment(segment); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Size returns the total size of all segments in bytes.
+func (s *Spool) Size() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.size
+}
+
+// Close closes the segment in use. Records stay on disk for the next Open.
+func (s *Spool) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	return s.sealSegment()
+}
+
+func (s *Spool) replaySegment(segment uint64, handle func(record []byte) error) error {
+	f, err := os.Open(s.path(segment))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil // dropped because of the size limit
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	for {
+		record, err := readRecord(r)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			log.Warn("Skipping rest of corrupt spool segment", "segment", s.path(segment), "err", err)
+			return nil
+		}
+		if err := handle(record); err != nil {
+			return err
+		}
+	}
+}
+
+// readRecord reads one framed record. It returns io.EOF only at a clean end of
+// the segment.
+func readRecord(r io.Reader) ([]byte, error) {
+	header := make([]byte, headerSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return nil, fmt.Errorf("truncated record header")
+		}
+		return nil, err
+	}
+	length := binary.BigEndian.Uint32(header[0:4])
+	checksum := binary.BigEndian.Uint32(header[4:8])
+	if length > defaultSegmentSize*16 {
+		return nil, fmt.Errorf("invalid record length %d", length)
+	}
+	record := make([]byte, length)
+	if _, err := io.ReadFull(r, record); err != nil {
+		return nil, fmt.Errorf("truncated record: %w", err)
+	}
+	if crc32.ChecksumIEEE(record) != checksum {
+		return nil, fmt.Errorf("record checksum mismatch")
+	}
+	return record, nil
+}
+
+// makeRoom drops the oldest segments until a record of the given size fits.
+// The caller must hold the lock.
+func (s *Spool) makeRoom(recordSize int64) error {
+	if s.maxBytes <= 0 {
+		return nil
+	}
+	for s.size+recordSize > s.maxBytes {
+		segments, err := s.segments()
+		if err != nil {
+			return err
+		}
+		if len(segments) == 0 {
+			return fmt.Errorf("record of %d bytes exceeds spool limit of %d bytes", recordSize, s.maxBytes)
+		}
+		oldest := segments[0]
+		if s.current != nil && s.current.Name() == s.path(oldest) {
+			if err := s.sealSegment(); err != nil {
+				return err
+			}
+		}
+		log.Warn("Spool is full, dropping oldest segment", "segment", s.path(oldest))
+		if err := s.removeSegmentLocked(oldest); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// openSegment starts a new segment. The caller must hold the lock.
+func (s *Spool) openSegment() error {
+	f, err := os.OpenFile(s.path(s.next), os.O_CREATE|os.O_WRONLY|os.O_APPEND|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	s.current = f
+	s.next++
+	return nil
+}
+
+// sealSegment closes the segment in use. The caller must hold the lock.
+func (s *Spool) sealSegment() error {
+	if s.current == nil {
+		return nil
+	}
+	err := s.current.Close()
+	s.current = nil
+	return err
+}
+
+func (s *Spool) removeSegment(segment uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.removeSegmentLocked(segment)
+}
+
+func (s *Spool) removeSegmentLocked(segment uint64) error {
+	path := s.path(segment)
+	info, err := os.Stat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil {
+		return err
+	}
+	s.size -= info.Size()
+	return nil
+}
+
+// segments returns the numbers of all segments, oldest first.
+func (s *Spool) segments() ([]uint64, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	var segments []uint64
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, segmentSuffix) {
+			continue
+		}
+		segment, err := strconv.ParseUint(strings.TrimSuffix(name, segmentSuffix), 10, 64)
+		if err != nil {
+			continue
+		}
+		segments = append(segments, segment)
+	}
+	sort.Slice(segments, func(i, j int) bool { return segments[i] < segments[j] })
+	return segments, nil
+}
+
+func (s *Spool) path(segment uint64) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%020d%s", segment, segmentSuffix))
+}
@@ -0,0 +1,125 @@
+package spool
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReplayInOrder(t *testing.T) {
+	s := openSpool(t, t.TempDir(), 0)
+	s.segmentSize = 32 // force several segments
+	appendRecords(t, s, "a", "b", "c", "d")
+
+	got := replayAll(t, s)
+	assertRecords(t, got, "a", "b", "c", "d")
+	if s.Size() != 0 {
+		t.Fatalf("Size() = %d after replay, want 0", s.Size())
+	}
+	assertRecords(t, replayAll(t, s))
+}
+
+func TestReplayKeepsRecordsOnError(t *testing.T) {
+	s := openSpool(t, t.TempDir(), 0)
+	appendRecords(t, s, "a", "b")
+
+	wantErr := errors.New("unavailable")
+	err := s.Replay(func(record []byte) error { return wantErr })
+	if !errors.Is(err, wantErr) {
+		t.Fatalf("Replay returned %v, want %v", err, wantErr)
+	}
+
+	appendRecords(t, s, "c")
+	assertRecords(t, replayAll(t, s), "a", "b", "c")
+}
+
+func TestReopenKeepsRecords(t *testing.T) {
+	dir := t.TempDir()
+	s := openSpool(t, dir, 0)
+	appendRecords(t, s, "a", "b")
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	s = openSpool(t, dir, 0)
+	appendRecords(t, s, "c")
+	assertRecords(t, replayAll(t, s), "a", "b", "c")
+}
+
+func TestReplaySkipsTornRecord(t *testing.T) {
+	dir := t.TempDir()
+	s := openSpool(t, dir, 0)
+	appendRecords(t, s, "a", "b")
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Simulate a crash in the middle of writing the last record
+	path := filepath.Join(dir, "00000000000000000000.seg")
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Truncate(path, info.Size()-1); err != nil {
+		t.Fatal(err)
+	}
+
+	s = openSpool(t, dir, 0)
+	assertRecords(t, replayAll(t, s), "a")
+}
+
+func TestSizeLimitDropsOldestSegment(t *testing.T) {
+	s := openSpool(t, t.TempDir(), 3*(headerSize+1))
+	s.segmentSize = headerSize + 1 // one record per segment
+	appendRecords(t, s, "a", "b", "c", "d")
+
+	assertRecords(t, replayAll(t, s), "b", "c", "d")
+}
+
+func openSpool(t *testing.T, dir string, maxBytes int64) *Spool {
+	t.Helper()
+
+	s, err := Open(dir, maxBytes)
+	if err != nil {
+		t.Fatalf("Open returned error: %v", err)
+	}
+	return s
+}
+
+func appendRecords(t *testing.T, s *Spool, records ...string) {
+	t.Helper()
+
+	for _, record := range records {
+		if err := s.Append([]byte(record)); err != nil {
+			t.Fatalf("Append(%q) returned error: %v", record, err)
+		}
+	}
+}
+
+func replayAll(t *testing.T, s *Spool) []string {
+	t.Helper()
+
+	var records []string
+	err := s.Replay(func(record []byte) error {
+		records = append(records, string(record))
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Replay returned error: %v", err)
+	}
+	return records
+}
+
+func assertRecords(t *testing.T, got []string, want ...string) {
+	t.Helper()
+
+	if len(got) != len(want) {
+		t.Fatalf("records = %q, want %q", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("records = %q, want %q", got, want)
+		}
+	}
+}
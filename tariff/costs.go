@@ -0,0 +1,195 @@
+package tariff
+
+import (
+	"solarizer/energy"
+	"solarizer/solarweb"
+	"solarizer/statefile"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/log"
+	influxdb2 "github.com/influxdata/influxdb-client-go/v2"
+	"github.com/influxdata/influxdb-client-go/v2/api/write"
+)
+
+// Costs of a period in the currency of the tariff.
+type Costs struct {
+	Import    float64 `json:"import"`     // cost of the grid import
+	FeedIn    float64 `json:"feed_in"`    // compensation for the grid export
+	BaseFee   float64 `json:"base_fee"`   // share of the monthly base fee
+	Net       float64 `json:"net"`        // import + base fee - feed in
+	WithoutPV float64 `json:"without_pv"` // cost if the whole load had been imported
+	Savings   float64 `json:"savings"`    // without PV - net
+}
+
+// Period holds the costs since Start.
+type Period struct {
+	Start time.Time `json:"start"`
+	Costs
+}
+
+// Snapshot holds the costs of the current hour, day and month.
+type Snapshot struct {
+	Time     time.Time `json:"time"`
+	Currency string    `json:"currency"`
+	Hour     Period    `json:"hour"`
+	Day      Period    `json:"day"`
+	Month    Period    `json:"month"`
+}
+
+// accumulated are the energy dependent costs of a period.
+type accumulated struct {
+	Import    float64 `json:"import"`
+	FeedIn    float64 `json:"feed_in"`
+	WithoutPV float64 `json:"without_pv"`
+}
+
+// costState is persisted after every sample.
+type costState struct {
+	Last       time.Time    `json:"last"`
+	Total      energy.Flows `json:"total"` // energy counters at Last
+	HourStart  time.Time    `json:"hour_start"`
+	Hour       accumulated  `json:"hour"`
+	DayStart   time.Time    `json:"day_start"`
+	Day        accumulated  `json:"day"`
+	MonthStart time.Time    `json:"month_start"`
+	Month      accumulated  `json:"month"`
+}
+
+// Calculator prices the energy counted by the integrator since the last
+// sample with the tariff valid at the time of the sample. It implements
+// influx.PowerObserver.
+type Calculator struct {
+	mu         sync.Mutex
+	tariff     Tariff
+	integrator *energy.Integrator
+	filename   string // optional, state is not persisted if empty
+	state      costState
+}
+
+// NewCalculator creates a calculator that persists its state in filename and
+// continues with the costs found there.
+func NewCalculator(tariff Tariff, integrator *energy.Integrator, filename string) (*Calculator, error) {
+	c := &Calculator{tariff: tariff, integrator: integrator, filename: filename}
+	if filename == "" {
+		return c, nil
+	}
+	restored, err := statefile.Load(filename, &c.state)
+	if err != nil {
+		return nil, err
+	}
+	if restored {
+		log.Info("Restored costs", "last", c.state.Last)
+	}
+	return c, nil
+}
+
+// ObservePower prices the energy of the sample and returns the measurements
+// "price" with the prices valid at the time of the sample, "costs_hour",
+// "costs_day" and "costs_month".
+func (c *Calculator) ObservePower(now time.Time, _ solarweb.CompareData) []*write.Point {
+	counters, ok := c.integrator.CountersAt(now)
+	if !ok {
+		return nil
+	}
+
+	c.mu.Lock()
+	st := &c.state
+	if hour := time.Date(now.Year(), now.Month(), now.Day(), now.Hour(), 0, 0, 0, now.Location()); !hour.Equal(st.HourStart) {
+		st.HourStart, st.Hour = hour, accumulated{}
+	}
+	if !counters.DayStart.Equal(st.DayStart) {
+		st.DayStart, st.Day = counters.DayStart, accumulated{}
+	}
+	if !counters.MonthStart.Equal(st.MonthStart) {
+		st.MonthStart, st.Month = counters.MonthStart, accumulated{}
+	}
+
+	// The costs of the interval crossing the start of an hour, day or month are
+	// counted for the new one, priced at the time of the sample
+	delta := counters.Total.Sub(st.Total)
+	if !st.Last.IsZero() && delta.GridImport >= 0 && delta.GridExport >= 0 && delta.Load >= 0 {
+		costs := c.price(now, delta)
+		st.Hour = st.Hour.add(costs)
+		st.Day = st.Day.add(costs)
+		st.Month = st.Month.add(costs)
+	}
+	st.Last, st.Total = now, counters.Total
+	if c.filename != "" {
+		if err := statefile.Save(c.filename, st); err != nil {
+			log.Error("Unable to persist costs", "err", err)
+		}
+	}
+	c.mu.Unlock()
+
+	snapshot := c.Snapshot()
+	return []*write.Point{
+		influxdb2.NewPointWithMeasurement("price").
+			AddTag("currency", snapshot.Currency).
+			AddField("import", c.tariff.ImportPriceAt(now)).
+			AddField("feed_in", c.tariff.FeedInPriceAt(now)).
+			SetTime(now),
+		newPoint("costs_hour", now, snapshot.Currency, snapshot.Hour.Costs),
+		newPoint("costs_day", now, snapshot.Currency, snapshot.Day.Costs),
+		newPoint("costs_month", now, snapshot.Currency, snapshot.Month.Costs),
+	}
+}
+
+// Snapshot returns the costs of the current hour, day and month. The hour and
+// the day include their share of the monthly base fee, the month the whole
+// fee.
+func (c *Calculator) Snapshot() Snapshot {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	st := c.state
+	daysInMonth := st.MonthStart.AddDate(0, 1, -1).Day()
+	return Snapshot{
+		Time:     st.Last,
+		Currency: c.tariff.Currency,
+		Hour:     Period{Start: st.HourStart, Costs: st.Hour.costs(c.tariff.MonthlyBaseFee / float64(daysInMonth) / 24)},
+		Day:      Period{Start: st.DayStart, Costs: st.Day.costs(c.tariff.MonthlyBaseFee / float64(daysInMonth))},
+		Month:    Period{Start: st.MonthStart, Costs: st.Month.costs(c.tariff.MonthlyBaseFee)},
+	}
+}
+
+// price returns the costs of the energy in Wh.
+func (c *Calculator) price(at time.Time, delta energy.Flows) accumulated {
+	importPrice := c.tariff.ImportPriceAt(at)
+	return accumulated{
+		Import:    delta.GridImport / 1000 * importPrice,
+		FeedIn:    delta.GridExport / 1000 * c.tariff.FeedInPriceAt(at),
+		WithoutPV: delta.Load / 1000 * importPrice,
+	}
+}
+
+func (a accumulated) add(o accumulated) accumulated {
+	return accumulated{
+		Import:    a.Import + o.Import,
+		FeedIn:    a.FeedIn + o.FeedIn,
+		WithoutPV: a.WithoutPV + o.WithoutPV,
+	}
+}
+
+func (a accumulated) costs(baseFee float64) Costs {
+	costs := Costs{
+		Import:    a.Import,
+		FeedIn:    a.FeedIn,
+		BaseFee:   baseFee,
+		Net:       a.Import + baseFee - a.FeedIn,
+		WithoutPV: a.WithoutPV + baseFee,
+	}
+	costs.Savings = costs.WithoutPV - costs.Net
+	return costs
+}
+
+func newPoint(measurement string, t time.Time, currency string, costs Costs) *write.Point {
+	return influxdb2.NewPointWithMeasurement(measurement).
+		AddTag("currency", currency).
+		AddField("import", costs.Import).
+		AddField("feed_in", costs.FeedIn).
+		AddField("base_fee", costs.BaseFee).
+		AddField("net", costs.Net).
+		AddField("without_pv", costs.WithoutPV).
+		AddField("savings", costs.Savings).
+		SetTime(t)
+}
@@ -0,0 +1,307 @@
+package tariff
+
+import (
+	"cmp"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/log"
+)
+
+const (
+	fetchTimeout = 30 * time.Second
+	// priceRetention is the time prices are kept before the end of the last
+	// loaded price
+	priceRetention = 7 * 24 * time.Hour
+	// defaultSlot is the length of the last price of a feed without end
+	defaultSlot = time.Hour
+)
+
+// Price is the dynamic price of a time slot, usually an hour. FeedIn is nil
+// if the feed only contains import prices.
+type Price struct {
+	Start  time.Time `json:"start"`
+	End    time.Time `json:"end"`
+	Import float64   `json:"price"`
+	FeedIn *float64  `json:"feed_in,omitempty"`
+}
+
+// PriceFeed loads dynamic prices from a file or an HTTP URL and refreshes
+// them periodically. Prices are per kWh in the currency of the tariff.
+//
+// JSON feeds contain an array of objects with the keys start (RFC 3339), price
+// and the optional keys end and feed_in. CSV feeds contain the columns start,
+// price and optionally feed_in, a header line is skipped. Without end, a price
+// is valid until the start of the next one.
+type PriceFeed struct {
+	source  string
+	refresh time.Duration
+	client  *http.Client
+
+	mu        sync.Mutex
+	prices    []Price // sorted by start
+	lastFetch time.Time
+	lastError error
+}
+
+// NewPriceFeed creates a feed for a file path or an http(s) URL.
+func NewPriceFeed(source string, refresh time.Duration) *PriceFeed {
+	return &PriceFeed{
+		source:  source,
+		refresh: refresh,
+		client:  &http.Client{Timeout: fetchTimeout},
+	}
+}
+
+// Run loads the prices and refreshes them until ctx is cancelled. Failed
+// loads are logged, the prices loaded before are kept.
+func (f *PriceFeed) Run(ctx context.Context) {
+	ticker := time.NewTicker(f.refresh)
+	defer ticker.Stop()
+	for {
+		if err := f.Load(ctx); err != nil && ctx.Err() == nil {
+			log.Error("Error loading prices", "source", f.source, "err", err)
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Load reads the feed and merges it into the known prices. Prices of the same
+// start are replaced.
+func (f *PriceFeed) Load(ctx context.Context) error {
+	prices, err := f.fetch(ctx)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.lastFetch, f.lastError = time.Now(), err
+	if err != nil {
+		return err
+	}
+
+	// Prices are kept for a while to price the energy of the past hours
+	byStart := make(map[int64]Price, len(f.prices)+len(prices))
+	cutoff := prices[len(prices)-1].End.Add(-priceRetention)
+	for _, price := range slices.Concat(f.prices, prices) {
+		if price.End.After(cutoff) {
+			byStart[price.Start.UnixMilli()] = price
+		}
+	}
+	f.prices = f.prices[:0]
+	for _, price := range byStart {
+		f.prices = append(f.prices, price)
+	}
+	slices.SortFunc(f.prices, func(a, b Price) int { return a.Start.Compare(b.Start) })
+	log.Debug("Loaded prices", "source", f.source, "count", len(prices))
+	return nil
+}
+
+// PriceAt returns the price of the slot containing t.
+func (f *PriceFeed) PriceAt(t time.Time) (Price, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	i, found := slices.BinarySearchFunc(f.prices, t, func(p Price, t time.Time) int { return p.Start.Compare(t) })
+	if !found {
+		i--
+	}
+	if i < 0 || !t.Before(f.prices[i].End) {
+		return Price{}, false
+	}
+	return f.prices[i], true
+}
+
+// Upcoming returns the prices of the slots ending after now and starting
+// before now + within.
+func (f *PriceFeed) Upcoming(now time.Time, within time.Duration) []Price {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	upcoming := []Price{}
+	for _, price := range f.prices {
+		if price.End.After(now) && price.Start.Before(now.Add(within)) {
+			upcoming = append(upcoming, price)
+		}
+	}
+	return upcoming
+}
+
+// SlotsFor returns the number of slots needed to cover the duration, based on
+// the length of the first slot, e.g. 4 slots for an hour of 15 minute prices.
+// It returns 0 without prices.
+func SlotsFor(prices []Price, d time.Duration) int {
+	if len(prices) == 0 {
+		return 0
+	}
+	length := prices[0].End.Sub(prices[0].Start)
+	if length <= 0 {
+		return 0
+	}
+	return int((d + length - 1) / length)
+}
+
+// Cheapest returns the n slots with the lowest import price, sorted by start.
+// If contiguous is set, the n adjacent slots with the lowest mean price are
+// returned instead. It returns nil if there are not enough slots.
+func Cheapest(prices []Price, n int, contiguous bool) []Price {
+	if n <= 0 || n > len(prices) {
+		return nil
+	}
+	if !contiguous {
+		cheapest := slices.Clone(prices)
+		slices.SortStableFunc(cheapest, func(a, b Price) int { return cmp.Compare(a.Import, b.Import) })
+		cheapest = cheapest[:n]
+		slices.SortFunc(cheapest, func(a, b Price) int { return a.Start.Compare(b.Start) })
+		return cheapest
+	}
+
+	var best []Price
+	bestSum := 0.0
+	for i := 0; i+n <= len(prices); i++ {
+		window := prices[i : i+n]
+		sum := 0.0
+		adjacent := true
+		for j, price := range window {
+			sum += price.Import
+			if j > 0 && !window[j-1].End.Equal(price.Start) {
+				adjacent = false
+				break
+			}
+		}
+		if adjacent && (best == nil || sum < bestSum) {
+			best, bestSum = window, sum
+		}
+	}
+	return slices.Clone(best)
+}
+
+// Status returns the time of the last load and its error.
+func (f *PriceFeed) Status() (time.Time, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.lastFetch, f.lastError
+}
+
+func (f *PriceFeed) fetch(ctx context.Context) ([]Price, error) {
+	if !strings.HasPrefix(f.source, "http://") && !strings.HasPrefix(f.source, "https://") {
+		file, err := os.Open(f.source)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		return parsePrices(file, strings.HasSuffix(strings.ToLower(f.source), ".csv"))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, f.source, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	isCSV := strings.Contains(resp.Header.Get("Content-Type"), "csv") ||
+		strings.HasSuffix(strings.ToLower(req.URL.Path), ".csv")
+	return parsePrices(resp.Body, isCSV)
+}
+
+type jsonPrice struct {
+	Start  time.Time  `json:"start"`
+	End    *time.Time `json:"end"`
+	Price  *float64   `json:"price"`
+	FeedIn *float64   `json:"feed_in"`
+}
+
+// parsePrices parses a JSON or CSV feed and fills in missing ends.
+func parsePrices(r io.Reader, isCSV bool) ([]Price, error) {
+	var prices []Price
+	if isCSV {
+		var err error
+		if prices, err = parseCSV(r); err != nil {
+			return nil, err
+		}
+	} else {
+		var items []jsonPrice
+		if err := json.NewDecoder(r).Decode(&items); err != nil {
+			return nil, fmt.Errorf("invalid JSON price feed: %w", err)
+		}
+		for _, item := range items {
+			if item.Price == nil {
+				return nil, fmt.Errorf("missing price of %s", item.Start)
+			}
+			price := Price{Start: item.Start, Import: *item.Price, FeedIn: item.FeedIn}
+			if item.End != nil {
+				price.End = *item.End
+			}
+			prices = append(prices, price)
+		}
+	}
+	if len(prices) == 0 {
+		return nil, errors.New("price feed is empty")
+	}
+
+	slices.SortFunc(prices, func(a, b Price) int { return a.Start.Compare(b.Start) })
+	for i := range prices {
+		if !prices[i].End.IsZero() {
+			continue
+		}
+		if i+1 < len(prices) {
+			prices[i].End = prices[i+1].Start
+		} else {
+			prices[i].End = prices[i].Start.Add(defaultSlot)
+		}
+	}
+	return prices, nil
+}
+
+func parseCSV(r io.Reader) ([]Price, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("invalid CSV price feed: %w", err)
+	}
+
+	var prices []Price
+	for i, record := range records {
+		if len(record) < 2 {
+			return nil, fmt.Errorf("line %d: expected start and price", i+1)
+		}
+		start, err := time.Parse(time.RFC3339, record[0])
+		if err != nil {
+			if i == 0 {
+				continue // header
+			}
+			return nil, fmt.Errorf("line %d: invalid start: %w", i+1, err)
+		}
+		price := Price{Start: start}
+		if price.Import, err = strconv.ParseFloat(record[1], 64); err != nil {
+			return nil, fmt.Errorf("line %d: invalid price: %w", i+1, err)
+		}
+		if len(record) > 2 && record[2] != "" {
+			feedIn, err := strconv.ParseFloat(record[2], 64)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid feed-in price: %w", i+1, err)
+			}
+			price.FeedIn = &feedIn
+		}
+		prices = append(prices, price)
+	}
+	return prices, nil
+}
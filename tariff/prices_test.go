@@ -0,0 +1,95 @@
+package tariff
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPriceFeedFromHTTP(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`[
+			{"start": "2025-06-01T10:00:00Z", "price": 0.30},
+			{"start": "2025-06-01T11:00:00Z", "price": 0.10, "feed_in": 0.02},
+			{"start": "2025-06-01T12:00:00Z", "end": "2025-06-01T12:30:00Z", "price": 0.20}
+		]`))
+	}))
+	defer server.Close()
+
+	feed := NewPriceFeed(server.URL+"/prices", time.Hour)
+	if err := feed.Load(context.Background()); err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	tariff := Tariff{ImportPrice: 0.35, FeedInPrice: 0.08, Prices: feed}
+	for clock, want := range map[string][2]float64{
+		"10:59": {0.30, 0.08},
+		"11:00": {0.10, 0.02},
+		"12:15": {0.20, 0.08},
+		"12:30": {0.35, 0.08}, // after the last price
+	} {
+		at, _ := time.Parse(time.RFC3339, "2025-06-01T"+clock+":00Z")
+		if got := [2]float64{tariff.ImportPriceAt(at), tariff.FeedInPriceAt(at)}; got != want {
+			t.Errorf("prices at %s = %v, want %v", clock, got, want)
+		}
+	}
+}
+
+func TestPriceFeedFromCSVFile(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "prices.csv")
+	content := "start,price\n" +
+		"2025-06-01T00:00:00+02:00,0.25\n" +
+		"2025-06-01T01:00:00+02:00,0.21\n" +
+		"2025-06-01T02:00:00+02:00,0.22\n" +
+		"2025-06-01T03:00:00+02:00,0.20\n" +
+		"2025-06-01T04:00:00+02:00,0.30\n"
+	if err := os.WriteFile(filename, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	feed := NewPriceFeed(filename, time.Hour)
+	if err := feed.Load(context.Background()); err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+
+	now, _ := time.Parse(time.RFC3339, "2025-06-01T00:30:00+02:00")
+	upcoming := feed.Upcoming(now, 24*time.Hour)
+	if len(upcoming) != 5 {
+		t.Fatalf("Upcoming returned %d prices, want 5", len(upcoming))
+	}
+
+	cheapest := Cheapest(upcoming, 2, false)
+	if len(cheapest) != 2 || cheapest[0].Import != 0.21 || cheapest[1].Import != 0.20 {
+		t.Fatalf("Cheapest = %+v, want 01:00 and 03:00", cheapest)
+	}
+	cheapest = Cheapest(upcoming, 3, true)
+	if len(cheapest) != 3 || cheapest[0].Import != 0.21 || cheapest[2].Import != 0.20 {
+		t.Fatalf("contiguous Cheapest = %+v, want 01:00 to 04:00", cheapest)
+	}
+	if Cheapest(upcoming, 6, false) != nil {
+		t.Fatal("Cheapest returned prices for more slots than available")
+	}
+}
+
+func TestSlotsFor(t *testing.T) {
+	start := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	quarters := []Price{{Start: start, End: start.Add(15 * time.Minute)}}
+	hourly := []Price{{Start: start, End: start.Add(time.Hour)}}
+	for _, test := range []struct {
+		prices []Price
+		d      time.Duration
+		want   int
+	}{
+		{quarters, 2 * time.Hour, 8},
+		{quarters, 20 * time.Minute, 2},
+		{hourly, 2 * time.Hour, 2},
+		{nil, time.Hour, 0},
+	} {
+		if got := SlotsFor(test.prices, test.d); got != test.want {
+			t.Errorf("SlotsFor(%v, %s) = %d, want %d", test.prices, test.d, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package tariff
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Tariff describes the electricity contract. Prices are per kWh.
+type Tariff struct {
+	Currency       string
+	ImportPrice    float64  // price of grid import outside of all windows
+	FeedInPrice    float64  // compensation for grid export
+	TimeOfUse      []Window // import prices of time windows, the first matching window applies
+	MonthlyBaseFee float64
+	Prices         *PriceFeed // optional dynamic prices, take precedence over all other prices
+}
+
+// Window is a daily time window with its own import price. Start and End are
+// offsets from midnight in local time, a window ending before its start
+// extends over midnight.
+type Window struct {
+	Start time.Duration
+	End   time.Duration
+	Price float64
+}
+
+// ImportPriceAt returns the import price at the given time.
+func (t Tariff) ImportPriceAt(at time.Time) float64 {
+	if t.Prices != nil {
+		if price, ok := t.Prices.PriceAt(at); ok {
+			return price.Import
+		}
+	}
+	offset := at.Sub(time.Date(at.Year(), at.Month(), at.Day(), 0, 0, 0, 0, at.Location()))
+	for _, window := range t.TimeOfUse {
+		if window.contains(offset) {
+			return window.Price
+		}
+	}
+	return t.ImportPrice
+}
+
+// FeedInPriceAt returns the feed-in compensation at the given time.
+func (t Tariff) FeedInPriceAt(at time.Time) float64 {
+	if t.Prices != nil {
+		if price, ok := t.Prices.PriceAt(at); ok && price.FeedIn != nil {
+			return *price.FeedIn
+		}
+	}
+	return t.FeedInPrice
+}
+
+func (w Window) contains(offset time.Duration) bool {
+	if w.Start <= w.End {
+		return offset >= w.Start && offset < w.End
+	}
+	return offset >= w.Start || offset < w.End
+}
+
+// ParseWindows parses a comma-separated list of windows in the format
+// "HH:MM-HH:MM=price", e.g. "22:00-06:00=0.22,12:00-14:00=0.18".
+func ParseWindows(value string) ([]Window, error) {
+	var windows []Window
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		span, price, ok := strings.Cut(item, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid window %q, expected HH:MM-HH:MM=price", item)
+		}
+		startValue, endValue, ok := strings.Cut(span, "-")
+		if !ok {
+			return nil, fmt.Errorf("invalid window %q, expected HH:MM-HH:MM=price", item)
+		}
+		var window Window
+		var err error
+		if window.Start, err = parseClock(startValue); err != nil {
+			return nil, err
+		}
+		if window.End, err = parseClock(endValue); err != nil {
+			return nil, err
+		}
+		if window.Price, err = strconv.ParseFloat(strings.TrimSpace(price), 64); err != nil {
+			return nil, fmt.Errorf("invalid price in window %q: %w", item, err)
+		}
+		windows = append(windows, window)
+	}
+	return windows, nil
+}
+
+// parseClock parses "HH:MM" into the offset from midnight, "24:00" is allowed
+// as end of the day.
+func parseClock(value string) (time.Duration, error) {
+	value = strings.TrimSpace(value)
+	if value == "24:00" {
+		return 24 * time.Hour, nil
+	}
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", value)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
@@ -0,0 +1,115 @@
+package tariff
+
+import (
+	"math"
+	"path/filepath"
+	"solarizer/energy"
+	"solarizer/solarweb"
+	"testing"
+	"time"
+)
+
+func TestImportPriceAt(t *testing.T) {
+	windows, err := ParseWindows("22:00-06:00=0.20, 12:00-14:00=0.25")
+	if err != nil {
+		t.Fatalf("ParseWindows returned error: %v", err)
+	}
+	tariff := Tariff{ImportPrice: 0.30, TimeOfUse: windows}
+	for clock, want := range map[string]float64{
+		"23:30": 0.20,
+		"05:59": 0.20,
+		"06:00": 0.30,
+		"12:00": 0.25,
+		"14:00": 0.30,
+	} {
+		at, _ := time.Parse("2006-01-02 15:04", "2025-06-01 "+clock)
+		if got := tariff.ImportPriceAt(at); got != want {
+			t.Errorf("ImportPriceAt(%s) = %v, want %v", clock, got, want)
+		}
+	}
+
+	for _, invalid := range []string{"22:00=0.2", "22:00-6=0.2", "22:00-06:00=cheap"} {
+		if _, err := ParseWindows(invalid); err == nil {
+			t.Errorf("ParseWindows(%q) succeeded, want error", invalid)
+		}
+	}
+}
+
+func TestCalculator(t *testing.T) {
+	integrator, _ := energy.Open("")
+	tariff := Tariff{Currency: "EUR", ImportPrice: 0.30, FeedInPrice: 0.08, MonthlyBaseFee: 15}
+	filename := filepath.Join(t.TempDir(), "costs.json")
+	calculator, err := NewCalculator(tariff, integrator, filename)
+	if err != nil {
+		t.Fatalf("NewCalculator returned error: %v", err)
+	}
+
+	// One hour of 1 kW import followed by one hour of 2 kW export, sampled
+	// every minute
+	start := time.Date(2025, 6, 1, 10, 0, 0, 0, time.UTC)
+	for i := range 121 {
+		now := start.Add(time.Duration(i) * time.Minute)
+		data := solarweb.CompareData{PowerGrid: 1000, PowerLoad: -1000}
+		if i > 60 {
+			data = solarweb.CompareData{PowerPV: 3000, PowerGrid: -2000, PowerLoad: -1000}
+		}
+		integrator.ObservePower(now, data)
+		calculator.ObservePower(now, data)
+	}
+
+	snapshot := calculator.Snapshot()
+	day := snapshot.Day
+	// The sample at 11:00 is the last one with import, the trapezoid up to
+	// 11:01 is half import and half export
+	wantImport := (1 + 1.0/120) * 0.30
+	wantFeedIn := (2 - 2.0/120) * 0.08
+	if math.Abs(day.Import-wantImport) > 1e-9 || math.Abs(day.FeedIn-wantFeedIn) > 1e-9 {
+		t.Fatalf("day costs = %+v, want import %v and feed in %v", day.Costs, wantImport, wantFeedIn)
+	}
+	if day.BaseFee != 0.5 || math.Abs(day.Net-(wantImport+0.5-wantFeedIn)) > 1e-9 {
+		t.Fatalf("day costs = %+v, want base fee 0.5", day.Costs)
+	}
+	if math.Abs(day.WithoutPV-(2*0.30+0.5)) > 1e-9 {
+		t.Fatalf("day costs = %+v, want 1.1 without PV", day.Costs)
+	}
+	if snapshot.Month.BaseFee != 15 {
+		t.Fatalf("month base fee = %v, want 15", snapshot.Month.BaseFee)
+	}
+
+	restored, err := NewCalculator(tariff, integrator, filename)
+	if err != nil {
+		t.Fatalf("NewCalculator returned error: %v", err)
+	}
+	if got := restored.Snapshot().Day.Import; got != day.Import {
+		t.Fatalf("restored day import = %v, want %v", got, day.Import)
+	}
+}
+
+func TestCalculatorCountsIntervalCrossingMidnight(t *testing.T) {
+	integrator, _ := energy.Open("")
+	calculator, err := NewCalculator(Tariff{Currency: "EUR", ImportPrice: 0.30}, integrator, "")
+	if err != nil {
+		t.Fatalf("NewCalculator returned error: %v", err)
+	}
+
+	// 1 kW import from 23:59 to 00:01 at the start of a month
+	data := solarweb.CompareData{PowerGrid: 1000, PowerLoad: -1000}
+	for _, now := range []time.Time{
+		time.Date(2025, 6, 30, 23, 59, 0, 0, time.Local),
+		time.Date(2025, 7, 1, 0, 1, 0, 0, time.Local),
+	} {
+		integrator.ObservePower(now, data)
+		calculator.ObservePower(now, data)
+	}
+
+	snapshot := calculator.Snapshot()
+	want := 2.0 / 60 * 0.30
+	for name, period := range map[string]Period{"hour": snapshot.Hour, "day": snapshot.Day, "month": snapshot.Month} {
+		if math.Abs(period.Import-want) > 1e-9 {
+			t.Errorf("%s import = %v, want %v", name, period.Import, want)
+		}
+	}
+	if !snapshot.Month.Start.Equal(time.Date(2025, 7, 1, 0, 0, 0, 0, time.Local)) {
+		t.Errorf("month start = %s, want July", snapshot.Month.Start)
+	}
+}